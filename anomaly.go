@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// anomalies injected into the generated readings
+const (
+	AnomalyOutage           = "outage"           // nothing is consumed, the state stays the same
+	AnomalyStuck            = "stuck"            // the register keeps reporting its last state
+	AnomalySpike            = "spike"            // the consumption of the interval is multiplied by the factor
+	AnomalyNegativeJump     = "negativeJump"     // the state drops by the factor times the consumption of the interval
+	AnomalyMeterReplacement = "meterReplacement" // the state starts again from zero
+	AnomalyMissing          = "missing"          // the reading of the interval is not stored
+	AnomalyDuplicate        = "duplicate"        // the reading of the interval is stored twice
+)
+
+const defaultAnomalyFactor = 10
+
+// Anomaly is a fault injected into the readings of a profile, either during the time window from From to To
+// (open ended without To) or at the given rate, the percentage of the intervals an occurrence starts at.
+// An occurrence started by the rate lasts the given number of intervals, one by default.
+// Negative jumps and meter replacements happen once, at the first interval of their window or occurrence.
+type Anomaly struct {
+	Type      string    `json:"type"`
+	Rate      float64   `json:"rate,omitempty"`
+	Intervals int       `json:"intervals,omitempty"`
+	From      time.Time `json:"from,omitempty"`
+	To        time.Time `json:"to,omitempty"`
+	Factor    float64   `json:"factor,omitempty"`
+}
+
+// AnomalyLabel marks an occurrence of an anomaly of the profile in its readings, from the interval
+// it started at to the last interval it affected. It is the ground truth to benchmark anomaly detection against.
+type AnomalyLabel struct {
+	Anomaly   int       `json:"anomaly"`
+	Type      string    `json:"type"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Intervals int       `json:"intervals"`
+	Planned   int       `json:"planned,omitempty"`
+}
+
+func (a Anomaly) once() bool {
+	return a.Type == AnomalyNegativeJump || a.Type == AnomalyMeterReplacement
+}
+
+func (a Anomaly) factor() float64 {
+	if a.Factor > 0 {
+		return a.Factor
+	}
+	return defaultAnomalyFactor
+}
+
+// applyAnomalies turns the reading generated on top of the state into the readings stored for its interval
+// after the anomalies hitting it: no reading, one reading or two readings.
+// It returns them along with the state the next reading continues from.
+func (p *Profile) applyAnomalies(rng *rand.Rand, reading Reading, state float64) ([]Reading, float64) {
+	if len(p.Anomalies) == 0 {
+		return []Reading{reading}, reading.State
+	}
+	label := p.anomalyAt(rng, reading.Time)
+	if label == nil {
+		return []Reading{reading}, reading.State
+	}
+	anomaly := p.Anomalies[label.Anomaly]
+	consumption := reading.State - state
+	switch anomaly.Type {
+	case AnomalyOutage:
+		// nothing is consumed, the next reading continues from the same state
+		reading.State = state
+		return []Reading{reading}, state
+	case AnomalyStuck:
+		// the register shows its last state while the meter still counts, the readings jump on recovery
+		next := reading.State
+		reading.State = state
+		if len(p.Readings) > 0 {
+			reading.State = p.Readings[len(p.Readings)-1].State
+		}
+		return []Reading{reading}, next
+	case AnomalySpike:
+		reading.State = state + consumption*anomaly.factor()
+	case AnomalyNegativeJump:
+		reading.State = state - consumption*anomaly.factor()
+		if reading.State < 0 {
+			reading.State = 0
+		}
+	case AnomalyMeterReplacement:
+		reading.State = consumption
+	case AnomalyMissing:
+		// the meter still counts, the consumption shows in the next reading
+		return nil, reading.State
+	case AnomalyDuplicate:
+		return []Reading{reading, reading}, reading.State
+	}
+	return []Reading{reading}, reading.State
+}
+
+// anomalyAt returns the label of the anomaly hitting the date, if any, after recording the date in it.
+// An occurrence still running goes first, then the windows and the rates in the order of the anomalies.
+func (p *Profile) anomalyAt(rng *rand.Rand, date time.Time) *AnomalyLabel {
+	interval := time.Duration(p.Interval) * time.Minute
+	var last *AnomalyLabel
+	if len(p.Labels) > 0 {
+		last = &p.Labels[len(p.Labels)-1]
+	}
+	continues := func(index int) bool {
+		return last != nil && last.Anomaly == index && last.End.Add(interval).Equal(date)
+	}
+	extend := func() *AnomalyLabel {
+		last.End = date
+		last.Intervals++
+		return last
+	}
+	start := func(index int, planned int) *AnomalyLabel {
+		p.Labels = append(p.Labels, AnomalyLabel{
+			Anomaly:   index,
+			Type:      p.Anomalies[index].Type,
+			Start:     date,
+			End:       date,
+			Intervals: 1,
+			Planned:   planned,
+		})
+		return &p.Labels[len(p.Labels)-1]
+	}
+
+	if last != nil && last.Planned > 0 && last.Intervals < last.Planned && continues(last.Anomaly) {
+		return extend()
+	}
+	for index, anomaly := range p.Anomalies {
+		if anomaly.From.IsZero() || date.Before(anomaly.From) || (!anomaly.To.IsZero() && !date.Before(anomaly.To)) {
+			continue
+		}
+		if anomaly.once() && !date.Before(anomaly.From.Add(interval)) {
+			continue
+		}
+		if continues(index) {
+			return extend()
+		}
+		return start(index, 0)
+	}
+	for index, anomaly := range p.Anomalies {
+		if anomaly.Rate <= 0 || !anomaly.From.IsZero() {
+			continue
+		}
+		if rng.Float64()*100 < anomaly.Rate {
+			planned := anomaly.Intervals
+			if planned < 1 || anomaly.once() {
+				planned = 1
+			}
+			return start(index, planned)
+		}
+	}
+	return nil
+}
+
+// lastLabelledInterval returns the last interval an anomaly affected, so that an interval
+// left without a reading by an anomaly is not generated again
+func (p Profile) lastLabelledInterval() time.Time {
+	if len(p.Labels) == 0 {
+		return time.Time{}
+	}
+	return p.Labels[len(p.Labels)-1].End
+}
+
+// LabelsFileName returns the name of the labels file written next to the readings file of the given name
+func LabelsFileName(readingsFile string) string {
+	return strings.TrimSuffix(readingsFile, filepath.Ext(readingsFile)) + ".labels.jsonl"
+}
+
+// WriteLabelsFile writes the labels of the profile as JSON lines next to its readings file
+func WriteLabelsFile(profile Profile, readingsFile string) error {
+	if len(profile.Labels) == 0 {
+		return nil
+	}
+	var lines bytes.Buffer
+	for _, label := range profile.Labels {
+		jsonBytes, err := json.Marshal(label)
+		if err != nil {
+			return err
+		}
+		lines.Write(jsonBytes)
+		lines.WriteByte('\n')
+	}
+	return ioutil.WriteFile(LabelsFileName(readingsFile), lines.Bytes(), 0644)
+}
+
+// ValidateAnomalies checks that every anomaly has a known type and either a rate or a window
+func ValidateAnomalies(p Profile) error {
+	types := []string{AnomalyOutage, AnomalyStuck, AnomalySpike, AnomalyNegativeJump,
+		AnomalyMeterReplacement, AnomalyMissing, AnomalyDuplicate}
+	for i, anomaly := range p.Anomalies {
+		if !IsValueInList(anomaly.Type, types) {
+			return fmt.Errorf("the anomaly %d has the type %s, should be one of: %+v", i+1, anomaly.Type, types)
+		}
+		if anomaly.Rate < 0 || anomaly.Rate > 100 {
+			return fmt.Errorf("the rate of the anomaly %d must be a percentage between 0 and 100, got %v", i+1, anomaly.Rate)
+		}
+		if anomaly.Rate == 0 && anomaly.From.IsZero() {
+			return fmt.Errorf("the anomaly %d needs either a rate or a window starting at from", i+1)
+		}
+		if anomaly.Rate > 0 && !anomaly.From.IsZero() {
+			return fmt.Errorf("the anomaly %d cannot have both a rate and a window", i+1)
+		}
+		if !anomaly.To.IsZero() && !anomaly.To.After(anomaly.From) {
+			return fmt.Errorf("the window of the anomaly %d ends before it starts", i+1)
+		}
+		if anomaly.Intervals < 0 || anomaly.Factor < 0 {
+			return fmt.Errorf("the intervals and factor of the anomaly %d cannot be negative", i+1)
+		}
+	}
+	return nil
+}
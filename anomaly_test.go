@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnomalyWindows(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Seed = 42
+	start := profile.Start
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	profile.Anomalies = []Anomaly{
+		{Type: AnomalyOutage, From: at(30), To: at(60)},
+		{Type: AnomalyMissing, From: at(60), To: at(75)},
+		{Type: AnomalyDuplicate, From: at(75), To: at(90)},
+		{Type: AnomalyMeterReplacement, From: at(105)},
+		{Type: AnomalySpike, From: at(120), To: at(135), Factor: 5},
+	}
+	assert.NoError(t, profile.Validate())
+	profile, err := GenerateReadingsBetween(profile, start, at(150))
+	assert.NoError(t, err)
+
+	var times []time.Time
+	for _, reading := range profile.Readings {
+		times = append(times, reading.Time)
+	}
+	assert.Equal(t, []time.Time{at(0), at(15), at(30), at(45), at(75), at(75), at(90), at(105), at(120), at(135)}, times)
+	readings := profile.Readings
+	assert.Equal(t, readings[1].State, readings[2].State)
+	assert.Equal(t, readings[2].State, readings[3].State)
+	assert.True(t, readings[4].State > readings[3].State)
+	assert.Equal(t, readings[4], readings[5])
+	assert.True(t, readings[7].State < readings[6].State)
+	assert.True(t, readings[8].State-readings[7].State > 2*(readings[9].State-readings[8].State))
+
+	assert.Equal(t, []AnomalyLabel{
+		{Anomaly: 0, Type: AnomalyOutage, Start: at(30), End: at(45), Intervals: 2},
+		{Anomaly: 1, Type: AnomalyMissing, Start: at(60), End: at(60), Intervals: 1},
+		{Anomaly: 2, Type: AnomalyDuplicate, Start: at(75), End: at(75), Intervals: 1},
+		{Anomaly: 3, Type: AnomalyMeterReplacement, Start: at(105), End: at(105), Intervals: 1},
+		{Anomaly: 4, Type: AnomalySpike, Start: at(120), End: at(120), Intervals: 1},
+	}, profile.Labels)
+}
+
+func TestStuckRegisterJumpsOnRecoveryUnlikeAnOutage(t *testing.T) {
+	generate := func(anomalyType string) []Reading {
+		profile := CreateDefaultProfile("")
+		profile.Seed = 42
+		profile.Anomalies = []Anomaly{{Type: anomalyType, From: profile.Start.Add(30 * time.Minute), To: profile.Start.Add(90 * time.Minute)}}
+		profile, err := GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(2*time.Hour))
+		assert.NoError(t, err)
+		return profile.Readings
+	}
+	outage := generate(AnomalyOutage)
+	stuck := generate(AnomalyStuck)
+
+	// both keep showing the last state during the anomaly
+	for i := 2; i < 6; i++ {
+		assert.Equal(t, outage[1].State, outage[i].State)
+		assert.Equal(t, stuck[1].State, stuck[i].State)
+	}
+	// after an outage the meter continues from the same state, a stuck register catches up with the consumption
+	assert.True(t, stuck[6].State-stuck[5].State > outage[6].State-outage[5].State)
+	assert.True(t, stuck[6].State > outage[6].State)
+	assert.InDelta(t, outage[7].State-outage[6].State, stuck[7].State-stuck[6].State, 1e-9)
+}
+
+func TestMissingReadingIsNotGeneratedAgain(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Anomalies = []Anomaly{{Type: AnomalyMissing, From: profile.Start.Add(15 * time.Minute), To: profile.Start.Add(30 * time.Minute)}}
+	profile = GenerateSingleReading(profile)
+	profile = GenerateSingleReading(profile)
+	assert.Len(t, profile.Readings, 1)
+	next, _, err := profile.StartAt()
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Start.Add(30*time.Minute), next)
+	profile = GenerateSingleReading(profile)
+	assert.Len(t, profile.Readings, 2)
+	assert.Len(t, profile.Labels, 1)
+}
+
+func TestAnomalyRateAndLabelsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-anomaly")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	profile := CreateDefaultProfile("")
+	profile.Seed = 7
+	profile.Anomalies = []Anomaly{{Type: AnomalyStuck, Rate: 5, Intervals: 4}}
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(7*24*time.Hour))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, profile.Labels)
+	for _, label := range profile.Labels {
+		assert.Equal(t, AnomalyStuck, label.Type)
+		assert.True(t, label.Intervals <= 4)
+		assert.Equal(t, label.Start.Add(time.Duration(label.Intervals-1)*15*time.Minute), label.End)
+	}
+
+	again := CreateDefaultProfile("")
+	again.Seed = 7
+	again.Anomalies = profile.Anomalies
+	again, err = GenerateReadingsBetween(again, again.Start, again.Start.Add(7*24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Labels, again.Labels)
+
+	assert.NoError(t, WriteProfileToFile(profile, dir, "house.json"))
+	labels, err := ioutil.ReadFile(filepath.Join(dir, "house.labels.jsonl"))
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(labels)), "\n"), len(profile.Labels))
+}
+
+func TestValidateAnomalies(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Anomalies = []Anomaly{{Type: "blackout", Rate: 1}}
+	assert.Error(t, ValidateAnomalies(profile))
+	profile.Anomalies = []Anomaly{{Type: AnomalySpike}}
+	assert.Error(t, ValidateAnomalies(profile))
+	profile.Anomalies = []Anomaly{{Type: AnomalySpike, Rate: 1, From: profile.Start}}
+	assert.Error(t, ValidateAnomalies(profile))
+	profile.Anomalies = []Anomaly{{Type: AnomalySpike, From: profile.Start, To: profile.Start}}
+	assert.Error(t, ValidateAnomalies(profile))
+	profile.Anomalies = []Anomaly{{Type: AnomalySpike, Rate: 0.5}, {Type: AnomalyOutage, From: profile.Start}}
+	assert.NoError(t, ValidateAnomalies(profile))
+}
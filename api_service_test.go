@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendReadingsActionMovesWatermark(t *testing.T) {
+	var batchSizes []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		document := map[string][]Resource{}
+		err := json.NewDecoder(r.Body).Decode(&document)
+		assert.NoError(t, err)
+		batchSizes = append(batchSizes, len(document["data"]))
+		if len(batchSizes) == 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err := GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(2*time.Hour))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL, BatchSize: 3})
+	assert.NoError(t, err)
+
+	profile, err = service.sendReadingsAction(profile)
+	assert.Error(t, err)
+	assert.Equal(t, []int{3, 3, 2}, batchSizes)
+	assert.Equal(t, profile.Readings[5].Time, profile.Acknowledged["dev"])
+	assert.Len(t, profile.UnsentReadings("dev"), 2)
+	assert.Empty(t, profile.Readings[0].MeterId)
+
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 3, 2, 2}, batchSizes)
+	assert.Empty(t, profile.UnsentReadings("dev"))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// faults the chaos mode injects into the requests of a target
+const (
+	ChaosDrop      = "drop"
+	ChaosDelay     = "delay"
+	ChaosReorder   = "reorder"
+	ChaosTruncate  = "truncate"
+	ChaosCorrupt   = "corrupt"
+	ChaosDuplicate = "duplicate"
+	ChaosFuture    = "future"
+)
+
+const defaultChaosLogFileName = "chaos.jsonl"
+
+// ChaosConfig makes a target misbehave on purpose to exercise the robustness of the API.
+// Every fault is given as the percentage of the requests (or of the readings, for future timestamps) it hits:
+// a dropped payload is not sent and retried like a lost request, a delayed one is held back for the delay
+// (an hour by default), a reordered one is sent after the next one, truncated and corrupted bodies are no longer valid JSON,
+// a duplicated payload is sent twice and future readings are stamped later by the future offset (a day by default).
+// Faults are only injected within the daily windows of the schedule, or all the time without a schedule.
+// Every fault is logged as a JSON line into the log file.
+type ChaosConfig struct {
+	Drop      float64       `json:"drop,omitempty"`
+	Delay     float64       `json:"delay,omitempty"`
+	DelayBy   string        `json:"delayBy,omitempty"`
+	Reorder   float64       `json:"reorder,omitempty"`
+	Truncate  float64       `json:"truncate,omitempty"`
+	Corrupt   float64       `json:"corrupt,omitempty"`
+	Duplicate float64       `json:"duplicate,omitempty"`
+	Future    float64       `json:"future,omitempty"`
+	FutureBy  string        `json:"futureBy,omitempty"`
+	Schedule  []ChaosWindow `json:"schedule,omitempty"`
+	Seed      int64         `json:"seed,omitempty"`
+	Log       string        `json:"log,omitempty"`
+}
+
+// ChaosWindow is a daily period of the chaos schedule, from and to being times of the day like "02:00".
+// A window ending before it starts goes over midnight.
+type ChaosWindow struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ChaosFault is an entry of the chaos log
+type ChaosFault struct {
+	Time           time.Time `json:"time"`
+	Target         string    `json:"target"`
+	Fault          string    `json:"fault"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	Detail         string    `json:"detail,omitempty"`
+}
+
+// Validate checks the percentages, durations and windows of the chaos configuration
+func (c ChaosConfig) Validate() error {
+	for fault, percentage := range map[string]float64{
+		ChaosDrop: c.Drop, ChaosDelay: c.Delay, ChaosReorder: c.Reorder, ChaosTruncate: c.Truncate,
+		ChaosCorrupt: c.Corrupt, ChaosDuplicate: c.Duplicate, ChaosFuture: c.Future,
+	} {
+		if percentage < 0 || percentage > 100 {
+			return fmt.Errorf("the percentage of %s must be between 0 and 100, got %v", fault, percentage)
+		}
+	}
+	if _, _, err := c.offsets(); err != nil {
+		return err
+	}
+	for _, window := range c.Schedule {
+		if _, _, err := window.minutes(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c ChaosConfig) offsets() (time.Duration, time.Duration, error) {
+	delayBy, futureBy := time.Hour, 24*time.Hour
+	var err error
+	if c.DelayBy != "" {
+		delayBy, err = time.ParseDuration(c.DelayBy)
+		if err != nil {
+			return 0, 0, fmt.Errorf("the delay %s is not a valid duration: %s", c.DelayBy, err)
+		}
+	}
+	if c.FutureBy != "" {
+		futureBy, err = time.ParseDuration(c.FutureBy)
+		if err != nil {
+			return 0, 0, fmt.Errorf("the future offset %s is not a valid duration: %s", c.FutureBy, err)
+		}
+	}
+	return delayBy, futureBy, nil
+}
+
+func (w ChaosWindow) minutes() (int, int, error) {
+	from, err := time.Parse("15:04", w.From)
+	if err != nil {
+		return 0, 0, fmt.Errorf("the chaos window starts at %s, which is not a time like 02:00", w.From)
+	}
+	to, err := time.Parse("15:04", w.To)
+	if err != nil {
+		return 0, 0, fmt.Errorf("the chaos window ends at %s, which is not a time like 04:00", w.To)
+	}
+	return from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute(), nil
+}
+
+// WithheldError is returned for a payload the chaos mode did not send, so the API did not confirm it.
+// The payload is due again at RetryAt, or after the backoff of a failed request when RetryAt is zero.
+type WithheldError struct {
+	Fault   string
+	RetryAt time.Time
+}
+
+func (e *WithheldError) Error() string {
+	return fmt.Sprintf("the chaos mode withheld the payload (%s)", e.Fault)
+}
+
+// Chaos injects the faults of its configuration into the requests of a target.
+// Payloads it holds back are returned as withheld, the outbox of the sender keeps them until they are due.
+type Chaos struct {
+	Config  ChaosConfig
+	Target  string
+	LogPath string
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	delayBy  time.Duration
+	futureBy time.Duration
+}
+
+var (
+	chaosLock    sync.Mutex
+	chaosTargets = map[string]*Chaos{}
+)
+
+// ChaosFor returns the chaos of the target, shared by every service of the target
+// so that its faults follow a single sequence of its seed
+func ChaosFor(target Target) (*Chaos, error) {
+	chaosLock.Lock()
+	defer chaosLock.Unlock()
+	if chaos, ok := chaosTargets[target.Name]; ok {
+		return chaos, nil
+	}
+	chaos, err := NewChaos(target.Name, *target.Chaos)
+	if err != nil {
+		return nil, err
+	}
+	chaosTargets[target.Name] = chaos
+	return chaos, nil
+}
+
+func NewChaos(target string, config ChaosConfig) (*Chaos, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	delayBy, futureBy, _ := config.offsets()
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logPath := config.Log
+	if logPath == "" {
+		logPath = defaultChaosLogFileName
+	}
+	return &Chaos{
+		Config:   config,
+		Target:   target,
+		LogPath:  logPath,
+		rng:      rand.New(rand.NewSource(seed)),
+		delayBy:  delayBy,
+		futureBy: futureBy,
+	}, nil
+}
+
+// active tells if the schedule lets faults be injected at the given time
+func (c *Chaos) active(at time.Time) bool {
+	if len(c.Config.Schedule) == 0 {
+		return true
+	}
+	minute := at.Hour()*60 + at.Minute()
+	for _, window := range c.Config.Schedule {
+		from, to, _ := window.minutes()
+		if from <= to && minute >= from && minute < to {
+			return true
+		}
+		if from > to && (minute >= from || minute < to) {
+			return true
+		}
+	}
+	return false
+}
+
+// hits rolls the dice for a fault given as a percentage
+func (c *Chaos) hits(percentage float64) bool {
+	return percentage > 0 && c.rng.Float64()*100 < percentage
+}
+
+// ShiftToFuture stamps some of the readings later than they were taken
+func (c *Chaos) ShiftToFuture(readings []Reading) []Reading {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Config.Future == 0 || !c.active(clock.Now()) {
+		return readings
+	}
+	shifted := make([]Reading, len(readings))
+	for i, reading := range readings {
+		if c.hits(c.Config.Future) {
+			c.logFault(ChaosFuture, "", fmt.Sprintf("the reading at %s is sent at %s",
+				reading.Time.Format(time.RFC3339), reading.Time.Add(c.futureBy).Format(time.RFC3339)))
+			reading.Time = reading.Time.Add(c.futureBy)
+		}
+		shifted[i] = reading
+	}
+	return shifted
+}
+
+// Send posts the payload with the given send function, after injecting the faults that hit it.
+// A payload dropped, delayed or reordered is not sent and a WithheldError tells when it is due again:
+// a dropped payload is retried like a lost request, a delayed one after the delay and a reordered one
+// right away, after the payloads that follow it.
+func (c *Chaos) Send(body []byte, key string, send func([]byte, string) (*http.Response, []byte, error)) (*http.Response, []byte, error) {
+	c.mu.Lock()
+	now := clock.Now()
+	var (
+		withheld  *WithheldError
+		duplicate bool
+	)
+	if c.active(now) {
+		switch {
+		case c.hits(c.Config.Drop):
+			c.logFault(ChaosDrop, key, "the payload is never sent")
+			withheld = &WithheldError{Fault: ChaosDrop}
+		case c.hits(c.Config.Delay):
+			c.logFault(ChaosDelay, key, fmt.Sprintf("the payload is held back until %s", now.Add(c.delayBy).Format(time.RFC3339)))
+			withheld = &WithheldError{Fault: ChaosDelay, RetryAt: now.Add(c.delayBy)}
+		case c.hits(c.Config.Reorder):
+			c.logFault(ChaosReorder, key, "the payload is sent after the next one")
+			withheld = &WithheldError{Fault: ChaosReorder, RetryAt: now}
+		}
+		if withheld == nil {
+			if c.hits(c.Config.Truncate) && len(body) > 1 {
+				length := c.rng.Intn(len(body)-1) + 1
+				c.logFault(ChaosTruncate, key, fmt.Sprintf("the body is cut from %d to %d bytes", len(body), length))
+				body = body[:length]
+			}
+			if c.hits(c.Config.Corrupt) && len(body) > 0 {
+				body = c.corrupt(body)
+				c.logFault(ChaosCorrupt, key, "bytes of the body are replaced")
+			}
+			duplicate = c.hits(c.Config.Duplicate)
+			if duplicate {
+				c.logFault(ChaosDuplicate, key, "the payload is sent twice")
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	if withheld != nil {
+		return nil, nil, withheld
+	}
+	resp, respBody, err := send(body, key)
+	if duplicate {
+		resp, respBody, err = send(body, key)
+	}
+	return resp, respBody, err
+}
+
+// corrupt replaces a few bytes of the body with characters breaking the JSON syntax
+func (c *Chaos) corrupt(body []byte) []byte {
+	const garbage = `{}[]":,\`
+	corrupted := make([]byte, len(body))
+	copy(corrupted, body)
+	for i := 0; i < 1+len(body)/100; i++ {
+		corrupted[c.rng.Intn(len(corrupted))] = garbage[c.rng.Intn(len(garbage))]
+	}
+	return corrupted
+}
+
+// logFault writes the fault to the log and to the chaos log file
+func (c *Chaos) logFault(fault string, key string, detail string) {
+	entry := ChaosFault{Time: clock.Now(), Target: c.Target, Fault: fault, IdempotencyKey: key, Detail: detail}
+	log.Printf("chaos %s on %s: %s", fault, c.Target, detail)
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("Could not log the chaos fault", err)
+		return
+	}
+	logFile, err := os.OpenFile(c.LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("Could not log the chaos fault", err)
+		return
+	}
+	defer logFile.Close()
+	_, err = logFile.Write(append(jsonBytes, '\n'))
+	if err != nil {
+		log.Println("Could not log the chaos fault", err)
+	}
+}
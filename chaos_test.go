@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func chaosFaults(t *testing.T, path string) []string {
+	logFile, err := os.Open(path)
+	assert.NoError(t, err)
+	defer logFile.Close()
+	var faults []string
+	scanner := bufio.NewScanner(logFile)
+	for scanner.Scan() {
+		fault := ChaosFault{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &fault))
+		faults = append(faults, fault.Fault)
+	}
+	return faults
+}
+
+func TestChaosSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-chaos")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(previous Clock) { clock = previous }(clock)
+	start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock = NewSteppingClock(start)
+
+	var sent []string
+	send := func(body []byte, key string) (*http.Response, []byte, error) {
+		sent = append(sent, string(body))
+		return &http.Response{StatusCode: http.StatusCreated}, nil, nil
+	}
+	newChaos := func(config ChaosConfig) *Chaos {
+		config.Log = filepath.Join(dir, "chaos.jsonl")
+		chaos, err := NewChaos("dev", config)
+		assert.NoError(t, err)
+		return chaos
+	}
+
+	// dropped, reordered and delayed payloads are withheld, never answered as accepted
+	resp, _, err := newChaos(ChaosConfig{Drop: 100}).Send([]byte(`{"data":1}`), "key-1", send)
+	assert.Nil(t, resp)
+	assert.Equal(t, &WithheldError{Fault: ChaosDrop}, err)
+	_, _, err = newChaos(ChaosConfig{Reorder: 100}).Send([]byte("a"), "a", send)
+	assert.Equal(t, &WithheldError{Fault: ChaosReorder, RetryAt: start}, err)
+	_, _, err = newChaos(ChaosConfig{Delay: 100, DelayBy: "2h"}).Send([]byte("a"), "a", send)
+	assert.Equal(t, &WithheldError{Fault: ChaosDelay, RetryAt: start.Add(2 * time.Hour)}, err)
+	assert.Empty(t, sent)
+
+	// duplicated and truncated payloads
+	newChaos(ChaosConfig{Duplicate: 100, Truncate: 100}).Send([]byte(`{"data":{"id":"1"}}`), "d", send)
+	assert.Len(t, sent, 2)
+	assert.Equal(t, sent[0], sent[1])
+	assert.True(t, len(sent[0]) < len(`{"data":{"id":"1"}}`))
+	assert.False(t, json.Valid([]byte(sent[0])))
+
+	assert.Equal(t, []string{ChaosDrop, ChaosReorder, ChaosDelay, ChaosTruncate, ChaosDuplicate},
+		chaosFaults(t, filepath.Join(dir, "chaos.jsonl")))
+}
+
+func TestWithheldPayloadsAreNotConfirmed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-chaos")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(previous Clock) { clock = previous }(clock)
+	start := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock = NewSteppingClock(start)
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(HeaderIdempotencyKey))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(30*time.Minute))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL})
+	assert.NoError(t, err)
+	service.Outbox = NewOutbox(filepath.Join(dir, "outbox"))
+	service.Ledger = NewAckLedger(filepath.Join(dir, "acks.txt"))
+	service.Chaos, err = NewChaos("dev", ChaosConfig{Delay: 100, DelayBy: "2h", Log: filepath.Join(dir, "chaos.jsonl")})
+	assert.NoError(t, err)
+
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Empty(t, received)
+	keys := service.readingKeys(profile, profile.Readings)
+	confirmed, err := service.Ledger.ContainsAll(keys)
+	assert.NoError(t, err)
+	assert.False(t, confirmed)
+
+	// the held payloads are kept in the outbox and do not hold back the next readings
+	entries, err := service.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, ChaosDelay, entries[0].HeldBy)
+	assert.Equal(t, start.Add(2*time.Hour), entries[0].NextAttempt)
+	pending, err := service.FlushOutbox()
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+	// they are sent and confirmed once due
+	service.Chaos = nil
+	clock.Sleep(2 * time.Hour)
+	pending, err = service.FlushOutbox()
+	assert.NoError(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, keys, received)
+	confirmed, err = service.Ledger.ContainsAll(keys)
+	assert.NoError(t, err)
+	assert.True(t, confirmed)
+}
+
+func TestChaosFutureTimestampsAndSchedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-chaos")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(previous Clock) { clock = previous }(clock)
+	clock = NewSteppingClock(time.Date(2017, time.January, 1, 23, 30, 0, 0, time.UTC))
+
+	chaos, err := NewChaos("dev", ChaosConfig{
+		Future:   100,
+		FutureBy: "48h",
+		Schedule: []ChaosWindow{{From: "23:00", To: "01:00"}},
+		Log:      filepath.Join(dir, "chaos.jsonl"),
+	})
+	assert.NoError(t, err)
+	readings := []Reading{{Time: time.Date(2017, time.January, 1, 23, 15, 0, 0, time.UTC)}}
+	shifted := chaos.ShiftToFuture(readings)
+	assert.Equal(t, readings[0].Time.Add(48*time.Hour), shifted[0].Time)
+	assert.Equal(t, time.Date(2017, time.January, 1, 23, 15, 0, 0, time.UTC), readings[0].Time)
+
+	// out of the schedule, readings are left alone
+	clock.Sleep(2 * time.Hour)
+	assert.Equal(t, readings, chaos.ShiftToFuture(readings))
+}
+
+func TestChaosConfigValidate(t *testing.T) {
+	assert.NoError(t, ChaosConfig{Drop: 5, Delay: 1, DelayBy: "3h", Schedule: []ChaosWindow{{From: "02:00", To: "04:00"}}}.Validate())
+	assert.Error(t, ChaosConfig{Drop: 120}.Validate())
+	assert.Error(t, ChaosConfig{DelayBy: "later"}.Validate())
+	assert.Error(t, ChaosConfig{Schedule: []ChaosWindow{{From: "2am", To: "04:00"}}}.Validate())
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock tells the generator what time it is and lets it wait for the next reading.
+// Replacing it runs the generator faster than real time or steps through a period instantly.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// clock is the clock used by the generator, set from the command line options
+var clock Clock = realClock{}
+
+// realClock follows the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// scaledClock runs speed times faster than real time, starting at a simulated time
+type scaledClock struct {
+	realStart time.Time
+	start     time.Time
+	speed     float64
+}
+
+func NewScaledClock(start time.Time, speed float64) Clock {
+	return &scaledClock{realStart: time.Now(), start: start, speed: speed}
+}
+
+func (c *scaledClock) Now() time.Time {
+	elapsed := float64(time.Since(c.realStart)) * c.speed
+	return c.start.Add(time.Duration(elapsed))
+}
+
+func (c *scaledClock) Sleep(d time.Duration) {
+	time.Sleep(time.Duration(float64(d) / c.speed))
+}
+
+// Simulation is a clock shared by goroutines taking part in a simulation, its time only moves on
+// once all of them sleep. Goroutines join before they start and leave once they are done.
+type Simulation interface {
+	Join()
+	Leave()
+}
+
+// joinClock makes the calling goroutine take part in the simulation of the clock, if it is one
+func joinClock() {
+	if simulation, ok := clock.(Simulation); ok {
+		simulation.Join()
+	}
+}
+
+// leaveClock ends the part of the calling goroutine in the simulation of the clock, if it is one
+func leaveClock() {
+	if simulation, ok := clock.(Simulation); ok {
+		simulation.Leave()
+	}
+}
+
+// steppingClock never waits: once every goroutine of the simulation sleeps, its time jumps
+// to the earliest time a sleeper wakes up at and the sleepers due at that time wake up.
+// A goroutine which did not join sleeps on its own.
+type steppingClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	running  int
+	sleepers []sleeper
+}
+
+// sleeper is a goroutine sleeping on the stepping clock until the given time
+type sleeper struct {
+	until time.Time
+	wake  chan struct{}
+}
+
+func NewSteppingClock(start time.Time) Clock {
+	return &steppingClock{now: start}
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *steppingClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	wake := make(chan struct{})
+	c.sleepers = append(c.sleepers, sleeper{until: c.now.Add(d), wake: wake})
+	c.running--
+	c.advance()
+	c.mu.Unlock()
+	<-wake
+}
+
+func (c *steppingClock) Join() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running++
+}
+
+func (c *steppingClock) Leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+	c.advance()
+}
+
+// advance moves the time to the earliest wake up once nobody runs, and wakes up the sleepers due
+func (c *steppingClock) advance() {
+	if c.running > 0 || len(c.sleepers) == 0 {
+		return
+	}
+	earliest := c.sleepers[0].until
+	for _, s := range c.sleepers {
+		if s.until.Before(earliest) {
+			earliest = s.until
+		}
+	}
+	if earliest.After(c.now) {
+		c.now = earliest
+	}
+	remaining := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if s.until.After(c.now) {
+			remaining = append(remaining, s)
+			continue
+		}
+		c.running++
+		close(s.wake)
+	}
+	c.sleepers = remaining
+}
+
+// NewClock selects the clock for the command line options:
+// stepping instantly from the start to the end, running speed times faster than real time
+// or following the wall clock. Without a start, the simulated time starts now.
+func NewClock(speed float64, start time.Time, end time.Time, step bool) (Clock, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("the speed must be greater than 0, got %v", speed)
+	}
+	if step {
+		if start.IsZero() {
+			return nil, fmt.Errorf("stepping through time needs a start date")
+		}
+		if end.IsZero() {
+			return nil, fmt.Errorf("stepping through time needs an end date, it would never stop otherwise")
+		}
+		return NewSteppingClock(start), nil
+	}
+	if speed == 1 && start.IsZero() {
+		return realClock{}, nil
+	}
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return NewScaledClock(start, speed), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSteppingClock(t *testing.T) {
+	start := time.Date(2017, 01, 01, 00, 00, 00, 00, time.UTC)
+	c := NewSteppingClock(start)
+	c.Sleep(15 * time.Minute)
+	assert.Equal(t, start.Add(15*time.Minute), c.Now())
+}
+
+func TestScaledClock(t *testing.T) {
+	start := time.Date(2017, 01, 01, 00, 00, 00, 00, time.UTC)
+	c := NewScaledClock(start, 36000)
+	c.Sleep(time.Hour)
+	assert.True(t, c.Now().Sub(start) >= time.Hour)
+}
+
+func TestSteppingClockWakesUpTheEarliestSleeperFirst(t *testing.T) {
+	start := time.Date(2017, 01, 01, 00, 00, 00, 00, time.UTC)
+	clock = NewSteppingClock(start)
+	defer func() { clock = realClock{} }()
+
+	var (
+		mu    sync.Mutex
+		woken []string
+		wg    sync.WaitGroup
+	)
+	run := func(name string, interval time.Duration, times int) {
+		defer wg.Done()
+		defer leaveClock()
+		for i := 0; i < times; i++ {
+			clock.Sleep(interval)
+			mu.Lock()
+			woken = append(woken, fmt.Sprintf("%s %s", name, clock.Now().Format("15:04")))
+			mu.Unlock()
+		}
+	}
+	for _, profile := range []struct {
+		name     string
+		interval time.Duration
+		times    int
+	}{{"a", 15 * time.Minute, 4}, {"b", time.Hour, 1}, {"c", 30 * time.Minute, 2}} {
+		wg.Add(1)
+		joinClock()
+		go run(profile.name, profile.interval, profile.times)
+	}
+	wg.Wait()
+
+	// the time moves as if each sleeper had the clock on its own
+	assert.Equal(t, start.Add(time.Hour), clock.Now())
+	sort.Strings(woken)
+	assert.Equal(t, []string{"a 00:15", "a 00:30", "a 00:45", "a 01:00", "b 01:00", "c 00:30", "c 01:00"}, woken)
+}
+
+func TestNewClock(t *testing.T) {
+	start := time.Date(2017, 01, 01, 00, 00, 00, 00, time.UTC)
+	end := start.AddDate(0, 0, 7)
+
+	c, err := NewClock(1, time.Time{}, time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, realClock{}, c)
+
+	c, err = NewClock(96, start, end, true)
+	assert.NoError(t, err)
+	assert.Equal(t, start, c.Now())
+
+	_, err = NewClock(96, time.Time{}, end, true)
+	assert.Error(t, err)
+
+	// stepping without an end would never stop
+	_, err = NewClock(96, start, time.Time{}, true)
+	assert.Error(t, err)
+
+	_, err = NewClock(0, start, time.Time{}, false)
+	assert.Error(t, err)
+}
@@ -1,11 +1,24 @@
 package main
 
-import "gopkg.in/alecthomas/kingpin.v2"
+import (
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strconv"
+)
 
 var (
-	app        = kingpin.New("redgen", "RedGen random readings generator")
+	app          = kingpin.New("redgen", "RedGen random readings generator")
 	redgenConfig = app.Command("config", "Work with a configuration")
 
+	// --config "redgen.json"
+	redgenConfigFile = app.Flag("config", "The redgen configuration file listing the API targets").Default(defaultConfigFileName).String()
+
+	// mock-server --port 8080
+	redgenMockServer       = app.Command("mock-server", "Run a local stand-in for the readings API")
+	redgenMockServerPort   = redgenMockServer.Flag("port", "Port to listen on").Default("8080").Int()
+	redgenMockServerToken  = redgenMockServer.Flag("token", "Bearer token the requests must carry, any request is accepted when not set").String()
+	redgenMockServerStore  = redgenMockServer.Flag("store", "File the received readings are appended to").Default(defaultMockStoreFileName).String()
+	redgenMockServerScript = redgenMockServer.Flag("script", "JSON file scripting the status codes, delays and errors of the responses").String()
+
 	// config clear
 	redgenConfigClear = redgenConfig.Command("clear", "Clears the profiles folder")
 
@@ -16,7 +29,16 @@ var (
 	redgenConfigInit = redgenConfig.Command("init", "Create a default profile.")
 
 	// config start
-	redgenConfigStart = redgenConfig.Command("start", "Start running the application")
+	redgenConfigStart        = redgenConfig.Command("start", "Start running the application")
+	redgenConfigStartSeed    = redgenConfigStart.Flag("seed", "Seed the random source of every profile to get reproducible readings, 0 leaves it unseeded").Int64()
+	redgenConfigStartSpeed   = redgenConfigStart.Flag("speed", "Run the given times faster than real time").Default("1").Float64()
+	redgenConfigStartFrom    = redgenConfigStart.Flag("from", "Simulated time to start at, defaults to now").String()
+	redgenConfigStartTo      = redgenConfigStart.Flag("to", "Simulated time to stop at").String()
+	redgenConfigStartStep    = redgenConfigStart.Flag("step", "Step instantly through the time from --from to --to, both are required").Bool()
+	redgenConfigStartSink    = redgenConfigStart.Flag("sink", "Deliver the readings to the given sink of the configuration instead of the profile sinks").Strings()
+	redgenConfigStartRecord  = redgenConfigStart.Flag("record", "Record every request to the API and its response into the given directory").String()
+	redgenConfigStartWorkers = redgenConfigStart.Flag("workers", "Number of profiles processed at the same time").Default(strconv.Itoa(defaultWorkers)).Int()
+	redgenConfigStartRate    = redgenConfigStart.Flag("rate", "Maximum number of HTTP requests per second sent by all the sinks of all profiles, unlimited when not set").Float64()
 
 	// config generate "sample_file.json"
 	redgenConfigGenerate    = redgenConfig.Command("generate", "Create a default profile.")
@@ -26,18 +48,46 @@ var (
 	redgenConfigPreview        = redgenConfig.Command("preview", "Preview the default profile.")
 	redgenConfigPreviewArg     = redgenConfigPreview.Arg("file_to_preview.json", "Preview the given profile.").String()
 	redgenConfigPreviewArgTime = redgenConfigPreview.Flag("time", "Preview the given profile for a year|month|day.").String()
+	redgenConfigPreviewSeed    = redgenConfigPreview.Flag("seed", "Seed the random source to get reproducible readings, 0 leaves it unseeded").Int64()
 
 	// config validate "sample_file.json"
 	redgenConfigValidate    = redgenConfig.Command("validate", "Validates all configurations")
 	redgenConfigValidateArg = redgenConfigValidate.Arg("file_to_preview.json", "Validates the given configuration").String()
 
 	// config profile "sample_file.json"
-	redgenConfigProfile    = redgenConfig.Command("profile", "")
-	redgenConfigProfileArg = redgenConfigProfile.Arg("profile.json", "Validates the given configuration").String()
+	redgenConfigProfile      = redgenConfig.Command("profile", "")
+	redgenConfigProfileArg   = redgenConfigProfile.Arg("profile.json", "Validates the given configuration").String()
+	redgenConfigProfileSeed  = redgenConfigProfile.Flag("seed", "Seed the random source to get reproducible readings, 0 leaves it unseeded").Int64()
+	redgenConfigProfileSpeed = redgenConfigProfile.Flag("speed", "Generate the given times faster than real time, in real time when not set").Float64()
+	redgenConfigProfileTo    = redgenConfigProfile.Flag("to", "Simulated time to stop at").String()
+	redgenConfigProfileStep  = redgenConfigProfile.Flag("step", "Step instantly through the time until --to, which is required").Bool()
+
+	// config backfill "profile.json" --from 2017-01-01 --to 2018-01-01
+	redgenConfigBackfill     = redgenConfig.Command("backfill", "Generate the readings of a profile for a past period")
+	redgenConfigBackfillArg  = redgenConfigBackfill.Arg("profile.json", "The profile to generate the readings for").Required().String()
+	redgenConfigBackfillFrom = redgenConfigBackfill.Flag("from", "First day of the period, defaults to the last reading of the profile").String()
+	redgenConfigBackfillTo   = redgenConfigBackfill.Flag("to", "Day the period ends (exclusive)").Required().String()
+	redgenConfigBackfillSeed = redgenConfigBackfill.Flag("seed", "Seed the random source to get reproducible readings, 0 leaves it unseeded").Int64()
 
 	// config send
-	redgenConfigSend    = redgenConfig.Command("send", "A readings file should be sent along with this command")
-	redgenConfigSendArg = redgenConfigSend.Arg("file_to_send.json", "Send the readings in the file specified to the server").String()
+	redgenConfigSend       = redgenConfig.Command("send", "A readings file should be sent along with this command")
+	redgenConfigSendArg    = redgenConfigSend.Arg("file_to_send.json", "Send the readings in the file specified to the server").String()
+	redgenConfigSendSink   = redgenConfigSend.Flag("sink", "Deliver the readings to the given sink of the configuration instead of the profile sinks").Strings()
+	redgenConfigSendRecord = redgenConfigSend.Flag("record", "Record every request to the API and its response into the given directory").String()
+
+	// config replay "readings.json" --speed 60
+	redgenConfigReplay       = redgenConfig.Command("replay", "Send every reading of a readings file to the API at its original cadence")
+	redgenConfigReplayArg    = redgenConfigReplay.Arg("readings.json", "The readings file in ./readings to replay").Required().String()
+	redgenConfigReplaySpeed  = redgenConfigReplay.Flag("speed", "Replay the given times faster than the readings were taken").Default("1").Float64()
+	redgenConfigReplayFrom   = redgenConfigReplay.Flag("from", "Time of the first reading to replay").String()
+	redgenConfigReplayTo     = redgenConfigReplay.Flag("to", "Time the replayed readings end at (exclusive)").String()
+	redgenConfigReplayTarget = redgenConfigReplay.Flag("target", "Target of the configuration to replay to instead of the target of the profile").String()
+	redgenConfigReplayResume = redgenConfigReplay.Flag("resume", "Resume after the last reading an interrupted replay sent").Bool()
+
+	// config playback "recordings/" --target staging
+	redgenConfigPlayback       = redgenConfig.Command("playback", "Send the recorded requests to a target again and diff the responses")
+	redgenConfigPlaybackArg    = redgenConfigPlayback.Arg("dir", "The directory the requests were recorded into with --record").Required().String()
+	redgenConfigPlaybackTarget = redgenConfigPlayback.Flag("target", "Target of the configuration to play the requests back to, the default target when not set").String()
 
 	// config show
 	redgenConfigShow = redgenConfig.Command("show", "")
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultConfigFileName = "redgen.json"
+
+// authentication schemes of a target
+const (
+	AuthSchemeBearer = "bearer"
+	AuthSchemeBasic  = "basic"
+	AuthSchemeNone   = "none"
+	AuthSchemeOAuth2 = "oauth2"
+)
+
+// Config is the redgen configuration file, it lists the API targets and the other sinks the readings can be delivered to
+type Config struct {
+	DefaultTarget string                `json:"defaultTarget"`
+	Targets       map[string]Target     `json:"targets"`
+	DefaultSinks  []string              `json:"defaultSinks,omitempty"`
+	Sinks         map[string]SinkConfig `json:"sinks,omitempty"`
+}
+
+// Target is an API environment receiving readings.
+// The token is read from the configuration, an environment variable or a file, in that order.
+// With the oauth2 scheme, the token is the client secret used to get access tokens from the token url.
+// Readings are sent one by one unless a batch size is set, as JSON:API resources of the
+// resource type ("readings" by default).
+// Payloads that could not be delivered are retried after a delay doubling from the base delay
+// up to the max delay, both given as durations like "30s" or "1h".
+// The connection trusts the certificates of the CA file besides the system ones, authenticates
+// with the client certificate and key files when given, goes through the proxy and times out after the timeout.
+// A target with chaos misbehaves on purpose, see ChaosConfig.
+type Target struct {
+	Name       string            `json:"-"`
+	URL        string            `json:"url"`
+	AuthScheme string            `json:"authScheme,omitempty"`
+	Token      string            `json:"token,omitempty"`
+	TokenEnv   string            `json:"tokenEnv,omitempty"`
+	TokenFile  string            `json:"tokenFile,omitempty"`
+	TokenURL   string            `json:"tokenUrl,omitempty"`
+	ClientID   string            `json:"clientId,omitempty"`
+	Scopes     []string          `json:"scopes,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	BatchSize  int               `json:"batchSize,omitempty"`
+
+	ResourceType string `json:"resourceType,omitempty"`
+	Sender       string `json:"sender,omitempty"`
+
+	RetryBaseDelay string `json:"retryBaseDelay,omitempty"`
+	RetryMaxDelay  string `json:"retryMaxDelay,omitempty"`
+
+	CAFile   string `json:"caFile,omitempty"`
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	Proxy    string `json:"proxy,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+
+	Chaos *ChaosConfig `json:"chaos,omitempty"`
+}
+
+// LoadConfig reads the redgen configuration file at the given path
+func LoadConfig(path string) (Config, error) {
+	config := Config{}
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("could not read the redgen configuration: %s", err)
+	}
+	err = json.Unmarshal(fileBytes, &config)
+	if err != nil {
+		return config, fmt.Errorf("could not parse the redgen configuration %s: %s", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks that the default target exists and that every target can be used
+func (c Config) Validate() error {
+	if c.DefaultTarget != "" {
+		if _, ok := c.Targets[c.DefaultTarget]; !ok {
+			return fmt.Errorf("the default target %s is not one of the configured targets", c.DefaultTarget)
+		}
+	}
+	for name, target := range c.Targets {
+		if target.URL == "" {
+			return fmt.Errorf("the target %s has no url", name)
+		}
+		switch target.AuthScheme {
+		case "", AuthSchemeBearer, AuthSchemeBasic, AuthSchemeNone:
+		case AuthSchemeOAuth2:
+			if target.TokenURL == "" || target.ClientID == "" {
+				return fmt.Errorf("the target %s needs a token url and a client id for oauth2", name)
+			}
+		default:
+			return fmt.Errorf("the target %s has an unknown auth scheme %s, should be one of: [ %s, %s, %s, %s ]",
+				name, target.AuthScheme, AuthSchemeBearer, AuthSchemeBasic, AuthSchemeOAuth2, AuthSchemeNone)
+		}
+		if _, _, err := target.RetryDelays(); err != nil {
+			return fmt.Errorf("the target %s has an invalid retry delay: %s", name, err)
+		}
+		if _, err := target.ClientTimeout(); err != nil {
+			return fmt.Errorf("the target %s has an invalid timeout: %s", name, err)
+		}
+		if (target.CertFile == "") != (target.KeyFile == "") {
+			return fmt.Errorf("the target %s needs both a certificate file and a key file for client certificates", name)
+		}
+		if target.Chaos != nil {
+			if err := target.Chaos.Validate(); err != nil {
+				return fmt.Errorf("the target %s has an invalid chaos configuration: %s", name, err)
+			}
+		}
+	}
+	for name, sink := range c.Sinks {
+		if err := sink.Validate(c); err != nil {
+			return fmt.Errorf("the sink %s is not valid: %s", name, err)
+		}
+	}
+	for _, name := range c.DefaultSinks {
+		if _, ok := c.Sinks[name]; !ok {
+			return fmt.Errorf("the default sink %s is not one of the configured sinks", name)
+		}
+	}
+	return nil
+}
+
+// TargetFor returns the target selected by the profile, or the default target when the profile selects none
+func (c Config) TargetFor(p Profile) (Target, error) {
+	name := p.Target
+	if name == "" {
+		name = c.DefaultTarget
+	}
+	if name == "" {
+		return Target{}, fmt.Errorf("the profile %s selects no target and no default target is configured", p.Name)
+	}
+	return c.Target(name)
+}
+
+// Target returns the target configured with the given name
+func (c Config) Target(name string) (Target, error) {
+	target, ok := c.Targets[name]
+	if !ok {
+		return Target{}, fmt.Errorf("the target %s is not configured", name)
+	}
+	target.Name = name
+	return target, nil
+}
+
+// ServiceFor creates the service sending the readings of the profile to its target
+func (c Config) ServiceFor(p Profile) (*LibrarianService, error) {
+	target, err := c.TargetFor(p)
+	if err != nil {
+		return nil, err
+	}
+	return NewLibrarianService(target)
+}
+
+// RetryDelays returns the base and max delays between two attempts to deliver a payload
+func (t Target) RetryDelays() (time.Duration, time.Duration, error) {
+	var (
+		baseDelay = defaultRetryBaseDelay
+		maxDelay  = defaultRetryMaxDelay
+		err       error
+	)
+	if t.RetryBaseDelay != "" {
+		baseDelay, err = time.ParseDuration(t.RetryBaseDelay)
+		if err != nil {
+			return baseDelay, maxDelay, err
+		}
+	}
+	if t.RetryMaxDelay != "" {
+		maxDelay, err = time.ParseDuration(t.RetryMaxDelay)
+		if err != nil {
+			return baseDelay, maxDelay, err
+		}
+	}
+	if baseDelay <= 0 || maxDelay < baseDelay {
+		return baseDelay, maxDelay, fmt.Errorf("the base delay %s must be positive and lower than the max delay %s", baseDelay, maxDelay)
+	}
+	return baseDelay, maxDelay, nil
+}
+
+// ResolveToken returns the token of the target from the first source that is set
+func (t Target) ResolveToken() (string, error) {
+	switch {
+	case t.Token != "":
+		return t.Token, nil
+	case t.TokenEnv != "":
+		token := os.Getenv(t.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("the environment variable %s holding the token is not set", t.TokenEnv)
+		}
+		return token, nil
+	case t.TokenFile != "":
+		tokenBytes, err := ioutil.ReadFile(t.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read the token file: %s", err)
+		}
+		return strings.TrimSpace(string(tokenBytes)), nil
+	}
+	return "", nil
+}
+
+// Authorization builds the value of the Authorization header for the target,
+// it is empty when the target needs no authentication.
+// For basic authentication the token holds the user and password as "user:password".
+// With oauth2 the header is set from the access token of every request instead.
+// A target asking for basic or bearer authentication, or giving a token source, fails without a token
+// rather than sending its requests unauthenticated.
+func (t Target) Authorization() (string, error) {
+	if t.AuthScheme == AuthSchemeNone || t.AuthScheme == AuthSchemeOAuth2 {
+		return "", nil
+	}
+	token, err := t.ResolveToken()
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		if t.AuthScheme != "" || t.TokenEnv != "" || t.TokenFile != "" {
+			return "", fmt.Errorf("the target %s needs a token for its authentication but none was resolved", t.Name)
+		}
+		return "", nil
+	}
+	if t.AuthScheme == AuthSchemeBasic {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(token)), nil
+	}
+	return "Bearer " + token, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, defaultConfigFileName)
+	err = ioutil.WriteFile(configPath, []byte(`{"defaultTarget":"dev","targets":{`+
+		`"dev":{"url":"http://localhost:8080/readings","authScheme":"none"},`+
+		`"staging":{"url":"https://staging.example.com/readings","tokenEnv":"REDGEN_TEST_TOKEN","headers":{"X-Tenant":"demo"}}}}`), 0644)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+
+	profile := CreateDefaultProfile("")
+	target, err := config.TargetFor(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/readings", target.URL)
+
+	profile.Target = "staging"
+	os.Setenv("REDGEN_TEST_TOKEN", "secret")
+	defer os.Unsetenv("REDGEN_TEST_TOKEN")
+	service, err := config.ServiceFor(profile)
+	assert.NoError(t, err)
+	req, err := service.BuildHTTPRequest([]byte("{}"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://staging.example.com/readings", req.URL.String())
+	assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	assert.Equal(t, "demo", req.Header.Get("X-Tenant"))
+
+	profile.Target = "production"
+	_, err = config.TargetFor(profile)
+	assert.Error(t, err)
+}
+
+func TestTargetAuthorization(t *testing.T) {
+	auth, err := Target{AuthScheme: AuthSchemeBasic, Token: "user:password"}.Authorization()
+	assert.NoError(t, err)
+	assert.Equal(t, "Basic dXNlcjpwYXNzd29yZA==", auth)
+
+	auth, err = Target{AuthScheme: AuthSchemeNone, Token: "ignored"}.Authorization()
+	assert.NoError(t, err)
+	assert.Equal(t, "", auth)
+
+	// a scheme needing a token fails rather than sending requests unauthenticated
+	_, err = Target{AuthScheme: AuthSchemeBearer}.Authorization()
+	assert.Error(t, err)
+	_, err = Target{AuthScheme: AuthSchemeBasic, Token: ""}.Authorization()
+	assert.Error(t, err)
+	auth, err = Target{}.Authorization()
+	assert.NoError(t, err)
+	assert.Equal(t, "", auth)
+
+	_, err = Target{TokenEnv: "REDGEN_UNSET_TOKEN"}.Authorization()
+	assert.Error(t, err)
+}
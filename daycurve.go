@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// day types a day curve applies to, besides the days of the week
+const (
+	DayTypeWeekday = "weekday"
+	DayTypeWeekend = "weekend"
+	DayTypeHoliday = "holiday"
+)
+
+// DayCurve is the 24 hours shape of the consumption of some days, replacing the hourly factors of the profile on them.
+// Days are days of the week ("Mon") or day types: weekday, weekend and holiday,
+// the dates listed in the holidays of the profile or given by its calendar.
+// A curve with months only applies to the days of these months, which gives seasonal curves.
+// On a given day, a curve for the holiday wins over a curve for the day of the week, which wins over a curve
+// for weekdays or weekends. Among curves for the same day, the first one of the profile wins.
+// Days without a curve use the hourly factors. The weekly and monthly factors still scale every curve.
+type DayCurve struct {
+	Days   []string           `json:"days"`
+	Months []string           `json:"months,omitempty"`
+	Hours  map[string]float64 `json:"hours"`
+}
+
+// applies tells if the curve is for the day type in the month
+func (c DayCurve) applies(dayType string, month string) bool {
+	return IsValueInList(dayType, c.Days) && (len(c.Months) == 0 || IsValueInList(month, c.Months))
+}
+
+// dayTypes returns what the local day of the date is, the most specific first
+func (p Profile) dayTypes(date time.Time) []string {
+	types := []string{date.Format("Mon"), DayTypeWeekday}
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		types[1] = DayTypeWeekend
+	}
+	if p.isHoliday(date) {
+		types = append([]string{DayTypeHoliday}, types...)
+	}
+	return types
+}
+
+// HourFactor returns the factor of the hour of the date: the value of the day curve applying to the day, if any,
+// otherwise the hourly factor of the profile
+func (p Profile) HourFactor(date time.Time) float64 {
+	hour := strconv.Itoa(date.Hour())
+	if len(p.DayCurves) == 0 {
+		return p.HourlyProfiles[hour]
+	}
+	month := date.Format("Jan")
+	for _, dayType := range p.dayTypes(date) {
+		for _, curve := range p.DayCurves {
+			if curve.applies(dayType, month) {
+				return curve.Hours[hour]
+			}
+		}
+	}
+	return p.HourlyProfiles[hour]
+}
+
+// ValidateDayCurves checks that every day curve is for known days and months
+// and gives a positive factor for each of the 24 hours, and that the holidays are dates like 2017-12-25
+func ValidateDayCurves(p Profile) error {
+	dayTypes := []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun", DayTypeWeekday, DayTypeWeekend, DayTypeHoliday}
+	for i, curve := range p.DayCurves {
+		if len(curve.Days) == 0 {
+			return fmt.Errorf("the day curve %d must be set for some days", i+1)
+		}
+		for _, day := range curve.Days {
+			if !IsValueInList(day, dayTypes) {
+				return fmt.Errorf("the day curve %d is for the day %s, should be one of: %+v", i+1, day, dayTypes)
+			}
+		}
+		for _, month := range curve.Months {
+			if _, ok := months[month]; !ok {
+				return fmt.Errorf("the day curve %d is for the month %s, which is not valid", i+1, month)
+			}
+		}
+		if len(curve.Hours) != 24 {
+			return fmt.Errorf("the day curve %d must give the 24 hours of the day, got %d", i+1, len(curve.Hours))
+		}
+		for hour, value := range curve.Hours {
+			if _, ok := defaultHourlyProfile[hour]; !ok {
+				return fmt.Errorf("the hour %s of the day curve %d is not a valid hour", hour, i+1)
+			}
+			if value <= 0 {
+				return fmt.Errorf("the hour %s of the day curve %d must be greater than 0, got %v", hour, i+1, value)
+			}
+		}
+	}
+	for _, holiday := range p.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			return fmt.Errorf("the holiday %s should be a date like 2017-12-25", holiday)
+		}
+	}
+	return nil
+}
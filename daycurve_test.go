@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// curve returns a day curve of the value for every hour but the peak
+func curve(value float64, peak int, peakValue float64) map[string]float64 {
+	hours := map[string]float64{}
+	for hour := range defaultHourlyProfile {
+		hours[hour] = value
+	}
+	hours[strconv.Itoa(peak)] = peakValue
+	return hours
+}
+
+func TestHourFactorUsesTheMostSpecificDayCurve(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.DayCurves = []DayCurve{
+		{Days: []string{DayTypeWeekday}, Hours: curve(1, 10, 4)},
+		{Days: []string{"Sun"}, Hours: curve(0.5, 10, 0.5)},
+		{Days: []string{DayTypeWeekday}, Months: []string{"Jul"}, Hours: curve(1, 10, 8)},
+		{Days: []string{DayTypeHoliday}, Hours: curve(0.2, 10, 0.2)},
+	}
+	profile.Holidays = []string{"2017-12-25"}
+	assert.NoError(t, profile.Validate())
+
+	// Monday, Sunday and Saturday of January
+	assert.Equal(t, 4.0, profile.HourFactor(time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 1.0, profile.HourFactor(time.Date(2017, 1, 2, 11, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 0.5, profile.HourFactor(time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, profile.HourlyProfiles["10"], profile.HourFactor(time.Date(2017, 1, 7, 10, 0, 0, 0, time.UTC)))
+	// the first curve matching the weekday wins, the one of July comes after the one of every month
+	assert.Equal(t, 4.0, profile.HourFactor(time.Date(2017, 7, 3, 10, 0, 0, 0, time.UTC)))
+	// Christmas is a Monday
+	assert.Equal(t, 0.2, profile.HourFactor(time.Date(2017, 12, 25, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestSeasonalDayCurve(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.DayCurves = []DayCurve{
+		{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Months: []string{"Jun", "Jul", "Aug"}, Hours: curve(1, 15, 3)},
+		{Days: []string{DayTypeWeekday}, Hours: curve(1, 15, 2)},
+	}
+	assert.NoError(t, profile.Validate())
+	assert.Equal(t, 3.0, profile.HourFactor(time.Date(2017, 7, 3, 15, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 2.0, profile.HourFactor(time.Date(2017, 1, 2, 15, 0, 0, 0, time.UTC)))
+
+	profile.Variability = 0
+	profile.Interval = 60
+	profile.Start = time.Date(2017, 7, 3, 0, 0, 0, 0, time.UTC)
+	profile, err := GenerateReadingsBetween(profile, time.Time{}, time.Date(2017, 7, 4, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.InDelta(t, 3*18.0/24, profile.Readings[15].State-profile.Readings[14].State, 1e-9)
+}
+
+func TestValidateDayCurves(t *testing.T) {
+	valid := DayCurve{Days: []string{"Sat"}, Hours: curve(1, 0, 1)}
+	assert.NoError(t, ValidateDayCurves(Profile{DayCurves: []DayCurve{valid}}))
+
+	for _, invalid := range []DayCurve{
+		{Hours: curve(1, 0, 1)},
+		{Days: []string{"Someday"}, Hours: curve(1, 0, 1)},
+		{Days: []string{"Sat"}, Months: []string{"Smarch"}, Hours: curve(1, 0, 1)},
+		{Days: []string{"Sat"}, Hours: map[string]float64{"0": 1}},
+		{Days: []string{"Sat"}, Hours: curve(1, 3, 0)},
+	} {
+		assert.Error(t, ValidateDayCurves(Profile{DayCurves: []DayCurve{invalid}}))
+	}
+	assert.Error(t, ValidateDayCurves(Profile{Holidays: []string{"25/12/2017"}}))
+}
@@ -5,13 +5,23 @@ var helpVersion = "v0.1"
 var helpMsg = `
 RedGen generates profiles for demonstration accounts
 	config start											Starts running the app, validate and send readings
+	config start --speed=96 --from=2017-01-01				Run the app 96 times faster than real time from the given date
+	config start --step --from=2017-01-01 --to=2017-01-08	Step instantly through the given period
 	config version											Show andy version
 	config preview "filename.json"							Show sample consumptions for the date
 	config profile											Path to demonstration profile file
+	config profile "filename.json" --seed=42				Generate reproducible readings for the profile
+	config profile "filename.json" --step --to=2017-02-01	Step instantly through the readings until the date
 	config generate   										Generate a new profile configuration with the default name
 	config generate "my_new_config.json"					Generate a new profile configuration with the name
+	config backfill "filename.json" --from=2017-01-01 --to=2018-01-01	Generate the readings of a past period
 	config send "readings_file.json"						Send the readings in the file to the API server
+	config replay "readings_file.json" --speed=60			Send every reading of the file at 60 times its original cadence
+	config start --record=recordings/						Record every request to the API and its response
+	config start --workers=32 --rate=50						Process 32 profiles at a time and send at most 50 requests per second
+	config playback recordings/ --target=staging			Send the recorded requests to another target and diff the responses
 	config show "readings_file.json" --date=2017-03-01		Show the consumption for the particular day
  	config validate 										Validates all the configuration files in the profiles folder
 	config validate "my_new_config.json"					Validate the provided configuration file
-	config init 											Create a default profile file `
+	config init 											Create a default profile file 
+	mock-server --port=8080 --token=secret --script=script.json	Run a local stand-in for the readings API`
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultHolidayDayType = "Sun"
+
+// HolidayCalendar gives the holidays of a profile, read from a local file of dates (one date like 2017-12-25
+// per line, followed by an optional name, lines starting with # being comments) or computed by the rules
+// of a built-in country calendar, or both. On a holiday, the weekly factor of the day type (Sunday by default)
+// or the factor, when set, replaces the weekly factor of the day.
+type HolidayCalendar struct {
+	File    string   `json:"file,omitempty"`
+	Country string   `json:"country,omitempty"`
+	DayType string   `json:"dayType,omitempty"`
+	Factor  *float64 `json:"factor,omitempty"`
+
+	// the holidays of the year looked up last
+	year  int
+	dates map[string]bool
+}
+
+// holiday is a rule of a built-in calendar giving the date of the holiday in a year
+type holiday struct {
+	name string
+	date func(year int) time.Time
+}
+
+// fixed is a holiday on the same date every year
+func fixed(name string, month time.Month, day int) holiday {
+	return holiday{name, func(year int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}}
+}
+
+// easterRelative is a holiday the given number of days after Easter Sunday
+func easterRelative(name string, days int) holiday {
+	return holiday{name, func(year int) time.Time {
+		return Easter(year).AddDate(0, 0, days)
+	}}
+}
+
+// nthWeekday is a holiday on the nth weekday of the month, the last one for -1
+func nthWeekday(name string, month time.Month, weekday time.Weekday, nth int) holiday {
+	return holiday{name, func(year int) time.Time {
+		if nth < 0 {
+			last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+			return last.AddDate(0, 0, -((int(last.Weekday()) - int(weekday) + 7) % 7))
+		}
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(nth-1))
+	}}
+}
+
+// holidayCountries holds the rules of the built-in calendars, public holidays moved to a weekday
+// when they fall on a weekend are not part of them
+var holidayCountries = map[string][]holiday{
+	"DE": {
+		fixed("Neujahr", time.January, 1),
+		easterRelative("Karfreitag", -2),
+		easterRelative("Ostermontag", 1),
+		fixed("Tag der Arbeit", time.May, 1),
+		easterRelative("Christi Himmelfahrt", 39),
+		easterRelative("Pfingstmontag", 50),
+		fixed("Tag der Deutschen Einheit", time.October, 3),
+		fixed("Erster Weihnachtstag", time.December, 25),
+		fixed("Zweiter Weihnachtstag", time.December, 26),
+	},
+	"FR": {
+		fixed("Jour de l'an", time.January, 1),
+		easterRelative("Lundi de Pâques", 1),
+		fixed("Fête du Travail", time.May, 1),
+		fixed("Victoire 1945", time.May, 8),
+		easterRelative("Ascension", 39),
+		easterRelative("Lundi de Pentecôte", 50),
+		fixed("Fête nationale", time.July, 14),
+		fixed("Assomption", time.August, 15),
+		fixed("Toussaint", time.November, 1),
+		fixed("Armistice 1918", time.November, 11),
+		fixed("Noël", time.December, 25),
+	},
+	"GB": {
+		fixed("New Year's Day", time.January, 1),
+		easterRelative("Good Friday", -2),
+		easterRelative("Easter Monday", 1),
+		nthWeekday("Early May bank holiday", time.May, time.Monday, 1),
+		nthWeekday("Spring bank holiday", time.May, time.Monday, -1),
+		nthWeekday("Summer bank holiday", time.August, time.Monday, -1),
+		fixed("Christmas Day", time.December, 25),
+		fixed("Boxing Day", time.December, 26),
+	},
+	"NL": {
+		fixed("Nieuwjaarsdag", time.January, 1),
+		easterRelative("Eerste Paasdag", 0),
+		easterRelative("Tweede Paasdag", 1),
+		fixed("Koningsdag", time.April, 27),
+		fixed("Bevrijdingsdag", time.May, 5),
+		easterRelative("Hemelvaartsdag", 39),
+		easterRelative("Eerste Pinksterdag", 49),
+		easterRelative("Tweede Pinksterdag", 50),
+		fixed("Eerste Kerstdag", time.December, 25),
+		fixed("Tweede Kerstdag", time.December, 26),
+	},
+	"US": {
+		fixed("New Year's Day", time.January, 1),
+		nthWeekday("Martin Luther King Jr. Day", time.January, time.Monday, 3),
+		nthWeekday("Washington's Birthday", time.February, time.Monday, 3),
+		nthWeekday("Memorial Day", time.May, time.Monday, -1),
+		fixed("Independence Day", time.July, 4),
+		nthWeekday("Labor Day", time.September, time.Monday, 1),
+		nthWeekday("Columbus Day", time.October, time.Monday, 2),
+		fixed("Veterans Day", time.November, 11),
+		nthWeekday("Thanksgiving Day", time.November, time.Thursday, 4),
+		fixed("Christmas Day", time.December, 25),
+	},
+}
+
+// HolidayCountries returns the countries with a built-in calendar
+func HolidayCountries() []string {
+	var countries []string
+	for country := range holidayCountries {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// Easter returns the date of Easter Sunday of the year in the Gregorian calendar
+func Easter(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// ReadHolidayFile reads the dates of a holiday file
+func ReadHolidayFile(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dates := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		date := strings.Fields(text)[0]
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("the line %d of the holiday file %s should start with a date like 2017-12-25", line, path)
+		}
+		dates[date] = true
+	}
+	return dates, scanner.Err()
+}
+
+// Contains tells if the local day of the date is a holiday of the calendar.
+// The holidays of a year are read and computed on the first day looked up in the year, and kept by the calendar
+// of the profile: a changed file is read again by the next run of the profile.
+func (c *HolidayCalendar) Contains(date time.Time) bool {
+	if c.dates == nil || c.year != date.Year() {
+		c.year = date.Year()
+		c.dates = c.holidaysOf(c.year)
+	}
+	return c.dates[date.Format("2006-01-02")]
+}
+
+// holidaysOf returns the holidays of the file and of the country of the calendar in the year
+func (c *HolidayCalendar) holidaysOf(year int) map[string]bool {
+	dates := map[string]bool{}
+	if c.File != "" {
+		fileDates, err := ReadHolidayFile(c.File)
+		if err != nil {
+			log.Println("Could not read the holiday file", err)
+		}
+		for date := range fileDates {
+			dates[date] = true
+		}
+	}
+	for _, rule := range holidayCountries[strings.ToUpper(c.Country)] {
+		dates[rule.date(year).Format("2006-01-02")] = true
+	}
+	return dates
+}
+
+// isHoliday tells if the local day of the date is one of the holidays listed by the profile or given by its calendar
+func (p Profile) isHoliday(date time.Time) bool {
+	if IsValueInList(date.Format("2006-01-02"), p.Holidays) {
+		return true
+	}
+	return p.HolidayCalendar != nil && p.HolidayCalendar.Contains(date)
+}
+
+// WeekFactor returns the weekly factor of the day of the date. Holidays take the weekly factor of the day type
+// of the holiday calendar (Sunday by default) or its factor instead.
+func (p Profile) WeekFactor(date time.Time) float64 {
+	if !p.isHoliday(date) {
+		return p.WeeklyProfiles[date.Format("Mon")]
+	}
+	calendar := p.HolidayCalendar
+	if calendar == nil {
+		return p.WeeklyProfiles[defaultHolidayDayType]
+	}
+	if calendar.Factor != nil {
+		return *calendar.Factor
+	}
+	if calendar.DayType != "" {
+		return p.WeeklyProfiles[calendar.DayType]
+	}
+	return p.WeeklyProfiles[defaultHolidayDayType]
+}
+
+// ValidateHolidayCalendar checks that the calendar reads a valid file or a known country,
+// and replaces the weekly factor of holidays by the one of a day of the week or a positive factor
+func ValidateHolidayCalendar(p Profile) error {
+	calendar := p.HolidayCalendar
+	if calendar == nil {
+		return nil
+	}
+	if calendar.File == "" && calendar.Country == "" {
+		return fmt.Errorf("the holiday calendar needs a file or a country")
+	}
+	if calendar.File != "" {
+		if _, err := ReadHolidayFile(calendar.File); err != nil {
+			return err
+		}
+	}
+	if _, ok := holidayCountries[strings.ToUpper(calendar.Country)]; calendar.Country != "" && !ok {
+		return fmt.Errorf("there is no holiday calendar for the country %s, should be one of: %+v", calendar.Country, HolidayCountries())
+	}
+	if _, ok := weekDays[calendar.DayType]; calendar.DayType != "" && !ok {
+		return fmt.Errorf("the day type %s of the holidays is not a day of the week like Sun", calendar.DayType)
+	}
+	if calendar.Factor != nil && *calendar.Factor < 0 {
+		return fmt.Errorf("the factor of the holidays cannot be negative, got %v", *calendar.Factor)
+	}
+	return nil
+}
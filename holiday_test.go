@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEaster(t *testing.T) {
+	for year, easter := range map[int]string{
+		2017: "2017-04-16",
+		2018: "2018-04-01",
+		2019: "2019-04-21",
+		2024: "2024-03-31",
+		2038: "2038-04-25",
+	} {
+		assert.Equal(t, easter, Easter(year).Format("2006-01-02"))
+	}
+}
+
+func TestBuiltInHolidayCalendars(t *testing.T) {
+	day := func(value string) time.Time {
+		date, _ := time.Parse("2006-01-02", value)
+		return date
+	}
+	us := HolidayCalendar{Country: "US"}
+	assert.True(t, us.Contains(day("2017-11-23")))
+	assert.True(t, us.Contains(day("2017-05-29")))
+	assert.True(t, us.Contains(day("2017-01-16")))
+	assert.False(t, us.Contains(day("2017-11-24")))
+
+	gb := HolidayCalendar{Country: "gb"}
+	assert.True(t, gb.Contains(day("2017-04-14")))
+	assert.True(t, gb.Contains(day("2017-05-01")))
+	assert.True(t, gb.Contains(day("2017-08-28")))
+	assert.True(t, gb.Contains(day("2017-12-26")))
+
+	de := HolidayCalendar{Country: "DE"}
+	assert.True(t, de.Contains(day("2017-05-25")))
+	assert.True(t, de.Contains(day("2017-10-03")))
+	assert.False(t, de.Contains(day("2017-07-14")))
+}
+
+func TestHolidaysUseTheWeeklyFactorOfTheirDayType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "holidays")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "holidays.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("# company closures\n2017-12-25 Christmas Day\n\n2017-12-27\n"), 0644))
+
+	profile := CreateDefaultProfile("")
+	profile.WeeklyProfiles = map[string]float64{"Mon": 2, "Tue": 2, "Wed": 2, "Thu": 2, "Fri": 2, "Sat": 0.5, "Sun": 0.25}
+	profile.HolidayCalendar = &HolidayCalendar{File: file}
+	assert.NoError(t, profile.Validate())
+
+	christmas := time.Date(2017, 12, 25, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 0.25, profile.WeekFactor(christmas))
+	assert.Equal(t, 2.0, profile.WeekFactor(christmas.AddDate(0, 0, 1)))
+	assert.Equal(t, 0.25, profile.WeekFactor(christmas.AddDate(0, 0, 2)))
+
+	profile.HolidayCalendar.DayType = "Sat"
+	assert.Equal(t, 0.5, profile.WeekFactor(christmas))
+	factor := 0.1
+	profile.HolidayCalendar.Factor = &factor
+	assert.Equal(t, 0.1, profile.WeekFactor(christmas))
+
+	// a site closed on holidays consumes nothing
+	jsonBytes := []byte(`{"file": "` + filepath.ToSlash(file) + `", "factor": 0}`)
+	closed := &HolidayCalendar{}
+	assert.NoError(t, json.Unmarshal(jsonBytes, closed))
+	profile.HolidayCalendar = closed
+	assert.Equal(t, 0.0, profile.WeekFactor(christmas))
+	assert.Equal(t, 2.0, profile.WeekFactor(christmas.AddDate(0, 0, 1)))
+
+	// the holidays of the calendar also take the holiday day curves
+	profile.DayCurves = []DayCurve{{Days: []string{DayTypeHoliday}, Hours: curve(0.3, 0, 0.3)}}
+	assert.Equal(t, 0.3, profile.HourFactor(christmas))
+
+	// the holidays listed by a profile without a calendar are like Sundays
+	profile.HolidayCalendar = nil
+	profile.Holidays = []string{"2017-12-26"}
+	assert.Equal(t, 0.25, profile.WeekFactor(christmas.AddDate(0, 0, 1)))
+	assert.Equal(t, 2.0, profile.WeekFactor(christmas))
+}
+
+func TestHolidayFileIsReadAgainByTheNextRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "holidays")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "holidays.txt")
+	christmas := time.Date(2017, 12, 25, 12, 0, 0, 0, time.UTC)
+
+	// a missing file is not remembered as empty
+	assert.False(t, (&HolidayCalendar{File: file}).Contains(christmas))
+	assert.NoError(t, ioutil.WriteFile(file, []byte("2017-12-25\n"), 0644))
+	calendar := &HolidayCalendar{File: file, Country: "DE"}
+	assert.True(t, calendar.Contains(christmas))
+	assert.True(t, calendar.Contains(time.Date(2018, 10, 3, 0, 0, 0, 0, time.UTC)))
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("2017-12-27\n"), 0644))
+	assert.False(t, (&HolidayCalendar{File: file}).Contains(christmas))
+}
+
+func TestValidateHolidayCalendar(t *testing.T) {
+	negative := -1.0
+	assert.NoError(t, ValidateHolidayCalendar(Profile{}))
+	assert.NoError(t, ValidateHolidayCalendar(Profile{HolidayCalendar: &HolidayCalendar{Country: "FR", DayType: "Sat"}}))
+	assert.Error(t, ValidateHolidayCalendar(Profile{HolidayCalendar: &HolidayCalendar{}}))
+	assert.Error(t, ValidateHolidayCalendar(Profile{HolidayCalendar: &HolidayCalendar{Country: "Atlantis"}}))
+	assert.Error(t, ValidateHolidayCalendar(Profile{HolidayCalendar: &HolidayCalendar{File: "no_such_file.txt"}}))
+	assert.Error(t, ValidateHolidayCalendar(Profile{HolidayCalendar: &HolidayCalendar{Country: "US", DayType: "holiday"}}))
+	assert.Error(t, ValidateHolidayCalendar(Profile{HolidayCalendar: &HolidayCalendar{Country: "US", Factor: &negative}}))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// interpolation modes of the hourly and monthly factors
+const (
+	InterpolationStep   = "step"   // the factor of the hour or month applies as is to all of it
+	InterpolationLinear = "linear" // the factors are joined by straight lines
+	InterpolationCubic  = "cubic"  // the factors are joined by a smooth Catmull-Rom spline
+)
+
+// smooth tells if the factors of the profile are interpolated rather than applied as steps
+func (p Profile) smooth() bool {
+	return p.Interpolation == InterpolationLinear || p.Interpolation == InterpolationCubic
+}
+
+// interpolate returns the value at the fraction t between the second and third of four evenly spaced values,
+// it never goes below zero
+func interpolate(mode string, values [4]float64, t float64) float64 {
+	v0, v1, v2, v3 := values[0], values[1], values[2], values[3]
+	value := v1 + (v2-v1)*t
+	if mode == InterpolationCubic {
+		value = 0.5 * (2*v1 + (v2-v0)*t + (2*v0-5*v1+4*v2-v3)*t*t + (3*v1-v0-3*v2+v3)*t*t*t)
+	}
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+// HourFactorAt returns the hourly factor at the date. When interpolated, the factor of an hour is
+// the level at the middle of the hour and the dates in between blend the factors of the hours around them.
+func (p Profile) HourFactorAt(date time.Time) float64 {
+	if !p.smooth() {
+		return p.HourFactor(date)
+	}
+	offset := float64(date.Minute())/60 + float64(date.Second())/3600 - 0.5
+	middle := date
+	if offset < 0 {
+		middle = date.Add(-time.Hour)
+		offset++
+	}
+	return interpolate(p.Interpolation, [4]float64{
+		p.HourFactor(middle.Add(-time.Hour)),
+		p.HourFactor(middle),
+		p.HourFactor(middle.Add(time.Hour)),
+		p.HourFactor(middle.Add(2 * time.Hour)),
+	}, offset)
+}
+
+// monthMiddle returns the middle of the month in the location, the month being normalized like time.Date does
+func monthMiddle(year int, month time.Month, location *time.Location) time.Time {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, location)
+	return start.Add(start.AddDate(0, 1, 0).Sub(start) / 2)
+}
+
+// MonthFactorAt returns the monthly factor at the date. When interpolated, the factor of a month is
+// the level at the middle of the month and the days in between blend the factors of the months around them.
+func (p Profile) MonthFactorAt(date time.Time) float64 {
+	factor := func(month time.Month) float64 {
+		return p.MonthlyProfiles[time.Date(date.Year(), month, 1, 0, 0, 0, 0, time.UTC).Format("Jan")]
+	}
+	if !p.smooth() {
+		return factor(date.Month())
+	}
+	month := date.Month()
+	if date.Before(monthMiddle(date.Year(), month, date.Location())) {
+		month--
+	}
+	from := monthMiddle(date.Year(), month, date.Location())
+	to := monthMiddle(date.Year(), month+1, date.Location())
+	t := float64(date.Sub(from)) / float64(to.Sub(from))
+	return interpolate(p.Interpolation, [4]float64{factor(month - 1), factor(month), factor(month + 1), factor(month + 2)}, t)
+}
+
+// ValidateInterpolation checks that the interpolation, when set, is a known mode
+func ValidateInterpolation(p Profile) error {
+	switch p.Interpolation {
+	case "", InterpolationStep, InterpolationLinear, InterpolationCubic:
+		return nil
+	}
+	return fmt.Errorf("the interpolation %s is not valid, should be one of: [ %s, %s, %s ]",
+		p.Interpolation, InterpolationStep, InterpolationLinear, InterpolationCubic)
+}
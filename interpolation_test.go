@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHourFactorIsInterpolatedBetweenTheMiddlesOfTheHours(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.HourlyProfiles["6"] = 3
+	at := func(hour, minute int) time.Time {
+		return time.Date(2017, 1, 2, hour, minute, 0, 0, time.UTC)
+	}
+
+	assert.Equal(t, 1.0, profile.HourFactorAt(at(5, 45)))
+	assert.Equal(t, 3.0, profile.HourFactorAt(at(6, 0)))
+
+	profile.Interpolation = InterpolationLinear
+	assert.NoError(t, profile.Validate())
+	assert.InDelta(t, 1.0, profile.HourFactorAt(at(5, 30)), 1e-9)
+	assert.InDelta(t, 1.5, profile.HourFactorAt(at(5, 45)), 1e-9)
+	assert.InDelta(t, 2.0, profile.HourFactorAt(at(6, 0)), 1e-9)
+	assert.InDelta(t, 3.0, profile.HourFactorAt(at(6, 30)), 1e-9)
+	assert.InDelta(t, 2.0, profile.HourFactorAt(at(7, 0)), 1e-9)
+
+	profile.Interpolation = InterpolationCubic
+	assert.InDelta(t, 3.0, profile.HourFactorAt(at(6, 30)), 1e-9)
+	assert.InDelta(t, 2.125, profile.HourFactorAt(at(6, 0)), 1e-9)
+	assert.True(t, profile.HourFactorAt(at(6, 15)) > profile.HourFactorAt(at(6, 0)))
+	// the spline dips below the flat factors next to the peak, but stays positive
+	assert.True(t, profile.HourFactorAt(at(4, 45)) < 1)
+	assert.True(t, profile.HourFactorAt(at(4, 45)) > 0)
+}
+
+func TestHourlyReadingsKeepThePeakOfTheirHour(t *testing.T) {
+	generate := func(interpolation string) []Reading {
+		profile := CreateDefaultProfile("")
+		// the factors of the default profile are shared, the test changes its own
+		profile.HourlyProfiles = map[string]float64{}
+		for hour := 0; hour < 24; hour++ {
+			profile.HourlyProfiles[strconv.Itoa(hour)] = 1
+		}
+		profile.HourlyProfiles["6"] = 3
+		profile.MonthlyProfiles = map[string]float64{}
+		for month := range months {
+			profile.MonthlyProfiles[month] = 1
+		}
+		profile.Interval = 60
+		profile.Variability = 0
+		profile.Interpolation = interpolation
+		start := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+		profile, err := GenerateReadingsBetween(profile, start, start.Add(12*time.Hour))
+		assert.NoError(t, err)
+		return profile.Readings
+	}
+	consumption := func(readings []Reading, hour int) float64 {
+		return readings[hour].State - readings[hour-1].State
+	}
+
+	step := generate(InterpolationStep)
+	for _, mode := range []string{InterpolationLinear, InterpolationCubic} {
+		readings := generate(mode)
+		assert.Equal(t, step[6].Time, readings[6].Time)
+		assert.InDelta(t, consumption(step, 6), consumption(readings, 6), 1e-9, mode)
+		assert.InDelta(t, consumption(step, 9), consumption(readings, 9), 1e-9, mode)
+	}
+}
+
+func TestMonthFactorIsContinuousAcrossMonths(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	// the monthly factors of the default profile are shared, the test changes its own
+	profile.MonthlyProfiles = map[string]float64{}
+	for month := range months {
+		profile.MonthlyProfiles[month] = 1
+	}
+	profile.MonthlyProfiles["Jan"] = 2
+	profile.MonthlyProfiles["Dec"] = 4
+	newYear := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 4.0, profile.MonthFactorAt(newYear.Add(-time.Minute)))
+	assert.Equal(t, 2.0, profile.MonthFactorAt(newYear))
+
+	profile.Interpolation = InterpolationLinear
+	assert.InDelta(t, 3.0, profile.MonthFactorAt(newYear), 1e-9)
+
+	for _, mode := range []string{InterpolationLinear, InterpolationCubic} {
+		profile.Interpolation = mode
+		assert.InDelta(t, profile.MonthFactorAt(newYear.Add(-time.Minute)), profile.MonthFactorAt(newYear), 1e-3)
+		assert.True(t, profile.MonthFactorAt(newYear) > 2 && profile.MonthFactorAt(newYear) < 4)
+		assert.InDelta(t, 2.0, profile.MonthFactorAt(monthMiddle(2017, time.January, time.UTC)), 1e-9)
+		assert.InDelta(t, 1.0, profile.MonthFactorAt(monthMiddle(2017, time.June, time.UTC)), 1e-9)
+	}
+}
+
+func TestValidateInterpolation(t *testing.T) {
+	assert.NoError(t, ValidateInterpolation(Profile{}))
+	assert.NoError(t, ValidateInterpolation(Profile{Interpolation: InterpolationCubic}))
+	assert.Error(t, ValidateInterpolation(Profile{Interpolation: "quadratic"}))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultResourceType = "readings"
+
+// Resource is a JSON:API resource object holding a reading in its attributes
+type Resource struct {
+	Type       string  `json:"type"`
+	ID         string  `json:"id"`
+	Attributes Reading `json:"attributes"`
+}
+
+// APIError is an error object of a JSON:API error document
+type APIError struct {
+	ID     string          `json:"id,omitempty"`
+	Status string          `json:"status,omitempty"`
+	Code   string          `json:"code,omitempty"`
+	Title  string          `json:"title,omitempty"`
+	Detail string          `json:"detail,omitempty"`
+	Source *APIErrorSource `json:"source,omitempty"`
+}
+
+// APIErrorSource points to the part of the request document that caused the error
+type APIErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+func (e APIError) Error() string {
+	message := e.Title
+	if e.Detail != "" {
+		message = e.Detail
+	}
+	if e.Code != "" {
+		message = fmt.Sprintf("%s (%s)", message, e.Code)
+	}
+	if e.Source != nil && e.Source.Pointer != "" {
+		message = fmt.Sprintf("%s at %s", message, e.Source.Pointer)
+	}
+	return message
+}
+
+// ResourceIndex returns the index of the resource of the request document the error points to.
+// A single resource document has its resource at index 0.
+func (e APIError) ResourceIndex() (int, bool) {
+	if e.Source == nil || !strings.HasPrefix(e.Source.Pointer, "/data") {
+		return 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(e.Source.Pointer, "/data"), "/")
+	if len(parts) < 2 {
+		return 0, true
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil {
+		// the pointer goes into the attributes of a single resource
+		return 0, true
+	}
+	return index, true
+}
+
+// ReadingError holds the errors the API reported for a reading
+type ReadingError struct {
+	Reading Reading
+	Errors  []APIError
+}
+
+func (e ReadingError) Error() string {
+	var messages []string
+	for _, apiError := range e.Errors {
+		messages = append(messages, apiError.Error())
+	}
+	return fmt.Sprintf("reading at %s: %s", e.Reading.Time.Format(time.RFC3339), strings.Join(messages, ", "))
+}
+
+// ResourceID identifies the reading of a meter by the meter and the time of the reading
+func ResourceID(meterId string, reading Reading) string {
+	return meterId + "-" + reading.Time.UTC().Format(time.RFC3339)
+}
+
+// NewResourceDocument creates the JSON:API document posting the readings of the meter.
+// A single reading is sent as a single resource, several readings as an array of resources.
+func NewResourceDocument(resourceType string, meterId string, sender string, readings []Reading) ([]byte, error) {
+	resources := make([]Resource, len(readings))
+	for i, reading := range readings {
+		reading.MeterId = meterId
+		reading.Sender = sender
+		resources[i] = Resource{
+			Type:       resourceType,
+			ID:         ResourceID(meterId, reading),
+			Attributes: reading,
+		}
+	}
+	if len(resources) == 1 {
+		return json.Marshal(map[string]Resource{"data": resources[0]})
+	}
+	return json.Marshal(map[string][]Resource{"data": resources})
+}
+
+// ParseAPIErrors reads the errors of a JSON:API error document, it returns none for any other body
+func ParseAPIErrors(body []byte) []APIError {
+	document := struct {
+		Errors []APIError `json:"errors"`
+	}{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil
+	}
+	return document.Errors
+}
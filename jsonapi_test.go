@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewResourceDocument(t *testing.T) {
+	reading := Reading{Time: time.Date(2017, 01, 01, 00, 15, 00, 00, time.UTC), State: 1.5, Unit: "kW"}
+
+	document, err := NewResourceDocument("readings", "meter-1", "", []Reading{reading})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"type":"readings","id":"meter-1-2017-01-01T00:15:00Z",`+
+		`"attributes":{"time":"2017-01-01T00:15:00Z","state":1.5,"unit":"kW","meter_id":"meter-1"}}}`, string(document))
+
+	document, err = NewResourceDocument("readings", "meter-1", "redgen", []Reading{reading, reading})
+	assert.NoError(t, err)
+	assert.Contains(t, string(document), `"data":[{"type":"readings"`)
+	assert.Contains(t, string(document), `"sender":"redgen"`)
+}
+
+func TestAPIErrorsAreReportedPerReading(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", HeaderContentType)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors":[` +
+			`{"status":"422","title":"Invalid state","detail":"state must grow","source":{"pointer":"/data/1/attributes/state"}},` +
+			`{"status":"422","title":"Invalid unit","source":{"pointer":"/data/1/attributes/unit"}},` +
+			`{"status":"422","title":"Meter is locked"}]}`))
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err := GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(time.Hour))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL, BatchSize: 2})
+	assert.NoError(t, err)
+
+	_, err = service.sendReadingsAction(profile)
+	statusErr, ok := err.(*StatusError)
+	assert.True(t, ok)
+	assert.Len(t, statusErr.Errors, 3)
+	assert.Len(t, statusErr.ReadingErrors, 1)
+	assert.Equal(t, profile.Readings[1], statusErr.ReadingErrors[0].Reading)
+	assert.Len(t, statusErr.ReadingErrors[0].Errors, 2)
+	assert.Contains(t, err.Error(), "reading at 2017-01-01T00:15:00Z: state must grow at /data/1/attributes/state, Invalid unit")
+}
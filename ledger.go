@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaultLedgerPath = filepath.Join(".", "acks")
+
+var (
+	ledgersLock sync.Mutex
+	ledgers     = map[string]*AckLedger{}
+)
+
+// IdempotencyKey identifies a reading of a profile for the API, so that a reading sent twice is only counted once.
+// The key only depends on the profile name, the meter id and the time of the reading.
+func IdempotencyKey(profileName string, meterId string, reading Reading) string {
+	sum := sha256.Sum256([]byte(profileName + "\n" + meterId + "\n" + reading.Time.UTC().Format(time.RFC3339Nano)))
+	return hex.EncodeToString(sum[:])
+}
+
+// BatchIdempotencyKey returns the key of the request posting the readings of the given keys.
+// A single reading is posted with its own key.
+func BatchIdempotencyKey(keys []string) string {
+	if len(keys) == 1 {
+		return keys[0]
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AckLedger records the idempotency keys of the readings the API confirmed, one per line.
+// The ledger outlives the watermark of the profile, which is only stored once every sink was delivered,
+// so a reading the API confirmed is never sent again even if redgen stops in between.
+type AckLedger struct {
+	Path string
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func NewAckLedger(path string) *AckLedger {
+	return &AckLedger{Path: path}
+}
+
+// ProfileAckLedger returns the ledger of the profile stored in the given file for the given sink.
+// The ledger is shared by every run of the profile, so its file is only read once.
+func ProfileAckLedger(filename string, sink string) *AckLedger {
+	path := filepath.Join(defaultLedgerPath, strings.TrimSuffix(filename, filepath.Ext(filename)), sink+".txt")
+	ledgersLock.Lock()
+	defer ledgersLock.Unlock()
+	ledger, ok := ledgers[path]
+	if !ok {
+		ledger = NewAckLedger(path)
+		ledgers[path] = ledger
+	}
+	return ledger
+}
+
+// Contains tells if the API confirmed the reading of the key
+func (l *AckLedger) Contains(key string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return false, err
+	}
+	return l.keys[key], nil
+}
+
+// ContainsAll tells if the API confirmed every reading of the keys
+func (l *AckLedger) ContainsAll(keys []string) (bool, error) {
+	for _, key := range keys {
+		confirmed, err := l.Contains(key)
+		if err != nil || !confirmed {
+			return false, err
+		}
+	}
+	return len(keys) > 0, nil
+}
+
+// Record appends the keys of readings the API confirmed to the ledger
+func (l *AckLedger) Record(keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return err
+	}
+	err := os.MkdirAll(filepath.Dir(l.Path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	ledgerFile, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer ledgerFile.Close()
+	for _, key := range keys {
+		if l.keys[key] {
+			continue
+		}
+		_, err = ledgerFile.WriteString(key + "\n")
+		if err != nil {
+			return err
+		}
+		l.keys[key] = true
+	}
+	return nil
+}
+
+// Retain drops the keys of the ledger but the given ones, so that it does not grow with every reading ever confirmed.
+// The ledger is written to a temporary file renamed over it, so that a crash never leaves it half written.
+func (l *AckLedger) Retain(keys []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return err
+	}
+	retained := map[string]bool{}
+	for _, key := range keys {
+		if l.keys[key] {
+			retained[key] = true
+		}
+	}
+	if len(retained) == len(l.keys) {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(l.Path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(l.Path), "."+filepath.Base(l.Path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	for key := range retained {
+		if _, err = tmpFile.WriteString(key + "\n"); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile.Name(), l.Path)
+	if err != nil {
+		return err
+	}
+	l.keys = retained
+	return nil
+}
+
+func (l *AckLedger) load() error {
+	if l.keys != nil {
+		return nil
+	}
+	keys := map[string]bool{}
+	ledgerFile, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		l.keys = keys
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer ledgerFile.Close()
+	scanner := bufio.NewScanner(ledgerFile)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys[key] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	l.keys = keys
+	return nil
+}
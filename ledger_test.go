@@ -0,0 +1,135 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	reading := Reading{Time: time.Date(2018, time.January, 1, 10, 0, 0, 0, time.UTC)}
+	key := IdempotencyKey("house", "meter-1", reading)
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, IdempotencyKey("house", "meter-1", Reading{Time: reading.Time.In(time.FixedZone("CET", 3600)), State: 12}))
+	assert.NotEqual(t, key, IdempotencyKey("office", "meter-1", reading))
+	assert.NotEqual(t, key, IdempotencyKey("house", "meter-2", reading))
+	assert.NotEqual(t, key, IdempotencyKey("house", "meter-1", Reading{Time: reading.Time.Add(time.Minute)}))
+
+	assert.Equal(t, key, BatchIdempotencyKey([]string{key}))
+	assert.NotEqual(t, key, BatchIdempotencyKey([]string{key, key}))
+}
+
+func TestIdempotencyKeyIsKeptOnRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-ledger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var keys []string
+	statusCodes := []int{http.StatusServiceUnavailable, http.StatusCreated}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statusCodes[len(keys)])
+		keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(15*time.Minute))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL, BatchSize: 2})
+	assert.NoError(t, err)
+	service.Outbox = NewOutbox(filepath.Join(dir, "outbox"))
+	service.Ledger = NewAckLedger(filepath.Join(dir, "acks.txt"))
+
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	pending, err := service.FlushOutbox()
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+	assert.Len(t, keys, 2)
+	readingKeys := service.readingKeys(profile, profile.Readings)
+	assert.Equal(t, BatchIdempotencyKey(readingKeys), keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	confirmed, err := NewAckLedger(filepath.Join(dir, "acks.txt")).ContainsAll(readingKeys)
+	assert.NoError(t, err)
+	assert.True(t, confirmed)
+}
+
+func TestConfirmedReadingsAreNotResent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-ledger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(30*time.Minute))
+	assert.NoError(t, err)
+	ledgerPath := filepath.Join(dir, "acks.txt")
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL})
+	assert.NoError(t, err)
+	service.Ledger = NewAckLedger(ledgerPath)
+	_, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// redgen stopped before the watermark was stored, the ledger remembers the readings were confirmed
+	restarted, err := NewLibrarianService(Target{Name: "dev", URL: server.URL})
+	assert.NoError(t, err)
+	restarted.Ledger = NewAckLedger(ledgerPath)
+	restarted.Outbox = NewOutbox(filepath.Join(dir, "outbox"))
+	body, err := restarted.BuildDocument(profile, profile.Readings[:1])
+	assert.NoError(t, err)
+	assert.NoError(t, restarted.Outbox.Enqueue(body, restarted.readingKeys(profile, profile.Readings[:1]), time.Time{}, nil))
+
+	profile, err = restarted.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	assert.Empty(t, profile.UnsentReadings("dev"))
+	entries, err := restarted.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLedgerIsPrunedBehindTheWatermark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-ledger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(time.Hour))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: "http://localhost"})
+	assert.NoError(t, err)
+	ledgerPath := filepath.Join(dir, "acks.txt")
+	service.Ledger = NewAckLedger(ledgerPath)
+	service.Outbox = NewOutbox(filepath.Join(dir, "outbox"))
+	keys := service.readingKeys(profile, profile.Readings)
+	assert.NoError(t, service.Ledger.Record(keys...))
+	assert.NoError(t, service.Outbox.Enqueue([]byte("{}"), keys[:1], time.Time{}, nil))
+
+	// the last reading is still after the watermark and the first one is queued in the outbox
+	profile.Acknowledge("dev", profile.Readings[2])
+	assert.NoError(t, service.PruneLedger(profile))
+	reloaded := NewAckLedger(ledgerPath)
+	for i, key := range keys {
+		confirmed, err := reloaded.Contains(key)
+		assert.NoError(t, err)
+		assert.Equal(t, i == 0 || i == 3, confirmed, "reading %d", i)
+	}
+
+	// the ledger of a profile and sink is kept for the whole run
+	assert.True(t, ProfileAckLedger("house.json", "dev") == ProfileAckLedger("house.json", "dev"))
+	assert.False(t, ProfileAckLedger("house.json", "dev") == ProfileAckLedger("house.json", "lake"))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultMockStoreFileName = "mock_received.jsonl"
+
+// MockResponse is a step of the script of the mock server. The step answers the given number of
+// requests (one when not set) with its status, after its delay, and with its JSON:API errors if any.
+type MockResponse struct {
+	Status     int        `json:"status,omitempty"`
+	Delay      string     `json:"delay,omitempty"`
+	RetryAfter string     `json:"retryAfter,omitempty"`
+	Errors     []APIError `json:"errors,omitempty"`
+	Times      int        `json:"times,omitempty"`
+}
+
+// MockScript lists the responses of the mock server in order. Once the script is over,
+// the server accepts every valid request, or starts the script again when it repeats.
+type MockScript struct {
+	Responses []MockResponse `json:"responses"`
+	Repeat    bool           `json:"repeat,omitempty"`
+}
+
+// MockRecord is a resource the mock server received and stored
+type MockRecord struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Resource
+}
+
+// MockServer imitates the readings endpoint of the API: it checks the Authorization header
+// and the shape of the JSON:API documents, and stores the resources it accepts as JSON lines
+type MockServer struct {
+	Token     string
+	StorePath string
+	Script    MockScript
+
+	mu       sync.Mutex
+	step     int
+	answered int
+}
+
+// LoadMockScript reads the script of the mock server from a JSON file
+func LoadMockScript(path string) (MockScript, error) {
+	script := MockScript{}
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return script, err
+	}
+	err = json.Unmarshal(fileBytes, &script)
+	if err != nil {
+		return script, fmt.Errorf("could not parse the mock server script %s: %s", path, err)
+	}
+	for i, response := range script.Responses {
+		if response.Delay != "" {
+			if _, err := time.ParseDuration(response.Delay); err != nil {
+				return script, fmt.Errorf("the response %d of the script has an invalid delay: %s", i+1, err)
+			}
+		}
+	}
+	return script, nil
+}
+
+// CmdMockServer runs the mock server on the given port until it is stopped
+func CmdMockServer(port int, token string, storePath string, scriptPath string) (string, error) {
+	server := &MockServer{Token: token, StorePath: storePath}
+	if scriptPath != "" {
+		script, err := LoadMockScript(scriptPath)
+		if err != nil {
+			return "", err
+		}
+		server.Script = script
+	}
+	address := fmt.Sprintf(":%d", port)
+	log.Printf("mock server listening on %s, storing readings into %s", address, storePath)
+	return "", http.ListenAndServe(address, server)
+}
+
+// nextResponse returns the step of the script answering the current request, if any
+func (m *MockServer) nextResponse() (MockResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.step >= len(m.Script.Responses) {
+		if !m.Script.Repeat || len(m.Script.Responses) == 0 {
+			return MockResponse{}, false
+		}
+		m.step = 0
+	}
+	response := m.Script.Responses[m.step]
+	m.answered++
+	times := response.Times
+	if times < 1 {
+		times = 1
+	}
+	if m.answered >= times {
+		m.step++
+		m.answered = 0
+	}
+	return response, true
+}
+
+func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("mock server received %s %s", r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		writeAPIErrors(w, http.StatusMethodNotAllowed, APIError{Title: "only POST is supported"})
+		return
+	}
+	if m.Token != "" && r.Header.Get("Authorization") != "Bearer "+m.Token {
+		writeAPIErrors(w, http.StatusUnauthorized, APIError{Title: "the Authorization header is missing or invalid"})
+		return
+	}
+
+	response, scripted := m.nextResponse()
+	if response.Delay != "" {
+		delay, _ := time.ParseDuration(response.Delay)
+		time.Sleep(delay)
+	}
+	if response.RetryAfter != "" {
+		w.Header().Set("Retry-After", response.RetryAfter)
+	}
+	if scripted && response.Status != 0 && (response.Status < 200 || response.Status > 299) {
+		errors := response.Errors
+		if len(errors) == 0 {
+			errors = []APIError{{Title: http.StatusText(response.Status)}}
+		}
+		writeAPIErrors(w, response.Status, errors...)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeAPIErrors(w, http.StatusBadRequest, APIError{Title: "could not read the request body"})
+		return
+	}
+	if r.Header.Get("Content-Type") != HeaderContentType {
+		writeAPIErrors(w, http.StatusUnsupportedMediaType, APIError{Title: "the Content-Type must be " + HeaderContentType})
+		return
+	}
+	resources, apiErrors := ParseResourceDocument(body)
+	if len(apiErrors) > 0 {
+		status := http.StatusUnprocessableEntity
+		if resources == nil {
+			status = http.StatusBadRequest
+		}
+		writeAPIErrors(w, status, apiErrors...)
+		return
+	}
+	err = m.store(resources)
+	if err != nil {
+		writeAPIErrors(w, http.StatusInternalServerError, APIError{Title: "could not store the readings", Detail: err.Error()})
+		return
+	}
+
+	status := http.StatusCreated
+	if scripted && response.Status != 0 {
+		status = response.Status
+	}
+	w.Header().Set("Content-Type", HeaderContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]Resource{"data": resources})
+}
+
+// store appends the resources to the store file of the server
+func (m *MockServer) store(resources []Resource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	storeFile, err := os.OpenFile(m.StorePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer storeFile.Close()
+	receivedAt := time.Now()
+	for _, resource := range resources {
+		jsonBytes, err := json.Marshal(MockRecord{ReceivedAt: receivedAt, Resource: resource})
+		if err != nil {
+			return err
+		}
+		_, err = storeFile.Write(append(jsonBytes, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseResourceDocument reads the resources of a JSON:API document posting readings,
+// and returns the errors of every resource that does not have the shape of a reading.
+// No resources are returned when the body is not a JSON:API document at all.
+func ParseResourceDocument(body []byte) ([]Resource, []APIError) {
+	document := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	err := json.Unmarshal(body, &document)
+	if err != nil || len(document.Data) == 0 {
+		return nil, []APIError{{Title: "the body must be a JSON:API document with data", Source: &APIErrorSource{Pointer: "/data"}}}
+	}
+	var (
+		resources []Resource
+		pointer   = "/data"
+	)
+	if document.Data[0] == '[' {
+		err = json.Unmarshal(document.Data, &resources)
+		pointer = "/data/%d"
+	} else {
+		resource := Resource{}
+		err = json.Unmarshal(document.Data, &resource)
+		resources = []Resource{resource}
+	}
+	if err != nil {
+		return nil, []APIError{{Title: "the data must hold reading resources", Detail: err.Error(), Source: &APIErrorSource{Pointer: "/data"}}}
+	}
+
+	var apiErrors []APIError
+	for i, resource := range resources {
+		resourcePointer := pointer
+		if pointer != "/data" {
+			resourcePointer = fmt.Sprintf(pointer, i)
+		}
+		invalid := func(field string, title string) {
+			apiErrors = append(apiErrors, APIError{
+				Status: strconv.Itoa(http.StatusUnprocessableEntity),
+				Title:  title,
+				Source: &APIErrorSource{Pointer: resourcePointer + field},
+			})
+		}
+		if resource.Type == "" {
+			invalid("/type", "the resource has no type")
+		}
+		if resource.ID == "" {
+			invalid("/id", "the resource has no id")
+		}
+		if resource.Attributes.Time.IsZero() {
+			invalid("/attributes/time", "the reading has no time")
+		}
+		if resource.Attributes.Unit == "" {
+			invalid("/attributes/unit", "the reading has no unit")
+		}
+		if resource.Attributes.State < 0 {
+			invalid("/attributes/state", "the state of the reading cannot be negative")
+		}
+	}
+	return resources, apiErrors
+}
+
+func writeAPIErrors(w http.ResponseWriter, status int, apiErrors ...APIError) {
+	for i := range apiErrors {
+		if apiErrors[i].Status == "" {
+			apiErrors[i].Status = strconv.Itoa(status)
+		}
+	}
+	w.Header().Set("Content-Type", HeaderContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]APIError{"errors": apiErrors})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mock := &MockServer{
+		Token:     "secret",
+		StorePath: filepath.Join(dir, defaultMockStoreFileName),
+		Script:    MockScript{Responses: []MockResponse{{Status: http.StatusServiceUnavailable, RetryAfter: "30"}}},
+	}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(time.Hour))
+	assert.NoError(t, err)
+
+	// the token is checked
+	service, err := NewLibrarianService(Target{Name: "mock", URL: server.URL, Token: "wrong", BatchSize: 2})
+	assert.NoError(t, err)
+	_, err = service.sendReadingsAction(profile)
+	assert.Equal(t, http.StatusUnauthorized, err.(*StatusError).StatusCode)
+
+	// the script answers first, then the readings are stored
+	service, err = NewLibrarianService(Target{Name: "mock", URL: server.URL, Token: "secret", BatchSize: 2})
+	assert.NoError(t, err)
+	_, err = service.sendReadingsAction(profile)
+	assert.Equal(t, http.StatusServiceUnavailable, err.(*StatusError).StatusCode)
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Empty(t, profile.UnsentReadings("mock"))
+
+	stored, err := ioutil.ReadFile(mock.StorePath)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(stored), "\n"))
+	assert.Contains(t, string(stored), `"id":"defaultprofile-2017-01-01T00:45:00Z"`)
+}
+
+func TestMockServerChecksThePayload(t *testing.T) {
+	server := httptest.NewServer(&MockServer{StorePath: filepath.Join(os.TempDir(), defaultMockStoreFileName)})
+	defer server.Close()
+
+	body := `{"data":[{"type":"readings","id":"1","attributes":{"time":"2017-01-01T00:00:00Z","state":1,"unit":"kW"}},` +
+		`{"type":"readings","attributes":{"state":1,"unit":"kW"}}]}`
+	resp, err := http.Post(server.URL, HeaderContentType, bytes.NewBufferString(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	apiErrors := ParseAPIErrors(respBody)
+	assert.Len(t, apiErrors, 2)
+	assert.Equal(t, "/data/1/id", apiErrors[0].Source.Pointer)
+	assert.Equal(t, "/data/1/attributes/time", apiErrors[1].Source.Pointer)
+
+	resp, err = http.Post(server.URL, HeaderContentType, bytes.NewBufferString(`{"readings":[]}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
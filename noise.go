@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// noise models of the hourly consumption
+const (
+	NoiseUniform   = "uniform"   // a uniform draw of ± variability/10, independent for each reading
+	NoiseGaussian  = "gaussian"  // a normal draw of standard deviation sigma, independent for each reading
+	NoiseLogNormal = "lognormal" // a factor whose logarithm is normal with standard deviation sigma, keeping the mean
+	NoiseAR1       = "ar1"       // a normal noise of standard deviation sigma, correlated by phi with the one of the previous interval
+)
+
+// NoiseModel draws the variations of the hourly consumption around its base. Sigma is given in the unit
+// of the profile for the gaussian and AR(1) models, and without a unit for the log-normal model. Phi is the correlation
+// of the AR(1) noise between consecutive intervals, from 0 (white noise) to 1 excluded. The uniform model uses the variability.
+type NoiseModel struct {
+	Model string  `json:"model"`
+	Sigma float64 `json:"sigma,omitempty"`
+	Phi   float64 `json:"phi,omitempty"`
+}
+
+// noisy tells if the profile draws its noise from a model other than the uniform variability
+func (p Profile) noisy() bool {
+	return p.Noise != nil && p.Noise.Model != "" && p.Noise.Model != NoiseUniform
+}
+
+// drawHourlyConsumption returns the base hourly consumption after the noise of the model, never below zero.
+// The AR(1) model keeps its noise in the profile, for the next reading to continue from it.
+func (p *Profile) drawHourlyConsumption(rng *rand.Rand, base float64) float64 {
+	var consumption float64
+	switch p.Noise.Model {
+	case NoiseGaussian:
+		consumption = base + rng.NormFloat64()*p.Noise.Sigma
+	case NoiseLogNormal:
+		sigma := p.Noise.Sigma
+		consumption = base * math.Exp(rng.NormFloat64()*sigma-sigma*sigma/2)
+	case NoiseAR1:
+		p.NoiseState = p.Noise.Phi*p.NoiseState + math.Sqrt(1-p.Noise.Phi*p.Noise.Phi)*p.Noise.Sigma*rng.NormFloat64()
+		consumption = base + p.NoiseState
+	}
+	return math.Max(0, consumption)
+}
+
+// ValidateNoise checks that the noise model is known and has a positive sigma, and a correlation within [0, 1) for AR(1)
+func ValidateNoise(p Profile) error {
+	if p.Noise == nil {
+		return nil
+	}
+	switch p.Noise.Model {
+	case "", NoiseUniform:
+		return nil
+	case NoiseGaussian, NoiseLogNormal, NoiseAR1:
+	default:
+		return fmt.Errorf("the noise model %s is not valid, should be one of: [ %s, %s, %s, %s ]",
+			p.Noise.Model, NoiseUniform, NoiseGaussian, NoiseLogNormal, NoiseAR1)
+	}
+	if p.Noise.Sigma <= 0 {
+		return fmt.Errorf("the sigma of the %s noise must be greater than 0, got %v", p.Noise.Model, p.Noise.Sigma)
+	}
+	if p.Noise.Phi < 0 || p.Noise.Phi >= 1 {
+		return fmt.Errorf("the phi of the noise must be at least 0 and less than 1, got %v", p.Noise.Phi)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// drawNoise draws n hourly consumptions around the base with the noise model
+func drawNoise(noise NoiseModel, base float64, n int) []float64 {
+	profile := Profile{Noise: &noise}
+	rng := rand.New(rand.NewSource(1))
+	draws := make([]float64, n)
+	for i := range draws {
+		draws[i] = profile.drawHourlyConsumption(rng, base)
+	}
+	return draws
+}
+
+// moments returns the mean, standard deviation and lag one autocorrelation of the values
+func moments(values []float64) (float64, float64, float64) {
+	var mean, variance, covariance float64
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+	for i, value := range values {
+		variance += (value - mean) * (value - mean)
+		if i > 0 {
+			covariance += (value - mean) * (values[i-1] - mean)
+		}
+	}
+	return mean, math.Sqrt(variance / float64(len(values))), covariance / variance
+}
+
+func TestNoiseModels(t *testing.T) {
+	mean, deviation, correlation := moments(drawNoise(NoiseModel{Model: NoiseGaussian, Sigma: 0.2}, 1, 20000))
+	assert.InDelta(t, 1, mean, 0.01)
+	assert.InDelta(t, 0.2, deviation, 0.01)
+	assert.InDelta(t, 0, correlation, 0.05)
+
+	mean, _, _ = moments(drawNoise(NoiseModel{Model: NoiseLogNormal, Sigma: 0.5}, 1, 20000))
+	assert.InDelta(t, 1, mean, 0.02)
+
+	mean, deviation, correlation = moments(drawNoise(NoiseModel{Model: NoiseAR1, Sigma: 0.2, Phi: 0.9}, 1, 20000))
+	assert.InDelta(t, 1, mean, 0.05)
+	assert.InDelta(t, 0.2, deviation, 0.03)
+	assert.InDelta(t, 0.9, correlation, 0.03)
+}
+
+func TestNoiseKeepsConsumptionNonNegative(t *testing.T) {
+	for _, model := range []string{NoiseGaussian, NoiseLogNormal, NoiseAR1} {
+		for _, draw := range drawNoise(NoiseModel{Model: model, Sigma: 3, Phi: 0.5}, 0.5, 1000) {
+			assert.True(t, draw >= 0)
+		}
+	}
+}
+
+func TestAR1NoiseResumesFromTheProfile(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Seed = 5
+	profile.Noise = &NoiseModel{Model: NoiseAR1, Sigma: 0.1, Phi: 0.8}
+	assert.NoError(t, profile.Validate())
+	for i := 0; i < 4; i++ {
+		profile = GenerateSingleReading(profile)
+	}
+	assert.NotZero(t, profile.NoiseState)
+
+	jsonBytes, err := json.Marshal(profile)
+	assert.NoError(t, err)
+	resumed, err := NewProfileFromJson(jsonBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, profile.NoiseState, resumed.NoiseState)
+	assert.Equal(t, GenerateSingleReading(profile).Readings[4], GenerateSingleReading(resumed).Readings[4])
+}
+
+func TestValidateNoise(t *testing.T) {
+	assert.NoError(t, ValidateNoise(Profile{}))
+	assert.NoError(t, ValidateNoise(Profile{Noise: &NoiseModel{Model: NoiseUniform}}))
+	assert.NoError(t, ValidateNoise(Profile{Noise: &NoiseModel{Model: NoiseAR1, Sigma: 0.1, Phi: 0.9}}))
+	assert.Error(t, ValidateNoise(Profile{Noise: &NoiseModel{Model: "pink"}}))
+	assert.Error(t, ValidateNoise(Profile{Noise: &NoiseModel{Model: NoiseGaussian}}))
+	assert.Error(t, ValidateNoise(Profile{Noise: &NoiseModel{Model: NoiseAR1, Sigma: 0.1, Phi: 1}}))
+}
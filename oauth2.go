@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokens are refreshed this long before they expire
+const tokenExpiryMargin = time.Minute
+
+// OAuth2TokenSource gets access tokens with the OAuth2 client credentials flow and caches them until shortly before they expire
+type OAuth2TokenSource struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Client       *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// tokenResponse is the answer of the token endpoint
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+var (
+	tokenSourcesLock sync.Mutex
+	tokenSources     = map[string]*OAuth2TokenSource{}
+)
+
+// TokenSourceFor returns the token source of the target, requesting tokens with the given client.
+// Sources are shared by every service of the same OAuth2 client, so that a token is only requested again once it expires.
+func TokenSourceFor(target Target, client *http.Client) (*OAuth2TokenSource, error) {
+	clientSecret, err := target.ResolveToken()
+	if err != nil {
+		return nil, err
+	}
+	key := strings.Join([]string{target.TokenURL, target.ClientID, clientSecret, strings.Join(target.Scopes, " ")}, "\n")
+	tokenSourcesLock.Lock()
+	defer tokenSourcesLock.Unlock()
+	source, ok := tokenSources[key]
+	if !ok {
+		source = &OAuth2TokenSource{
+			TokenURL:     target.TokenURL,
+			ClientID:     target.ClientID,
+			ClientSecret: clientSecret,
+			Scopes:       target.Scopes,
+			Client:       client,
+		}
+		tokenSources[key] = source
+	}
+	return source, nil
+}
+
+// Token returns the cached access token, or requests a new one when it is about to expire
+func (ts *OAuth2TokenSource) Token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && time.Now().Add(tokenExpiryMargin).Before(ts.expiry) {
+		return ts.token, nil
+	}
+	token, expiry, err := ts.requestToken()
+	if err != nil {
+		return "", err
+	}
+	ts.token = token
+	ts.expiry = expiry
+	return token, nil
+}
+
+// Invalidate drops the cached token, after the API refused it
+func (ts *OAuth2TokenSource) Invalidate() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.token = ""
+}
+
+func (ts *OAuth2TokenSource) requestToken() (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(ts.Scopes) > 0 {
+		form.Set("scope", strings.Join(ts.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, ts.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(ts.ClientID), url.QueryEscape(ts.ClientSecret))
+	resp, err := SendHTTPRequest(ts.Client, req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("could not request an access token: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	response := tokenResponse{}
+	err = json.Unmarshal(body, &response)
+	if resp.StatusCode != http.StatusOK || err != nil || response.AccessToken == "" {
+		if response.Error != "" {
+			return "", time.Time{}, fmt.Errorf("the token endpoint refused the client: %s %s", response.Error, response.ErrorDescription)
+		}
+		return "", time.Time{}, fmt.Errorf("the token endpoint responded with the status %s and no access token", resp.Status)
+	}
+	return response.AccessToken, tokenExpiry(response), nil
+}
+
+// tokenExpiry tells when the token expires from the expires_in of the response,
+// or the exp claim of the token when it is a JWT. Tokens without either are used for an hour.
+func tokenExpiry(response tokenResponse) time.Time {
+	if response.ExpiresIn > 0 {
+		return time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	parts := strings.Split(response.AccessToken, ".")
+	if len(parts) == 3 {
+		claims := struct {
+			Exp int64 `json:"exp"`
+		}{}
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err == nil && json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+			return time.Unix(claims.Exp, 0)
+		}
+	}
+	return time.Now().Add(time.Hour)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOAuth2TokenIsCachedAndRefreshedOn401(t *testing.T) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "redgen", clientID)
+		assert.Equal(t, "secret", clientSecret)
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		assert.Equal(t, "readings:write", r.FormValue("scope"))
+		issued++
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, issued)
+	}))
+	defer tokenServer.Close()
+
+	validToken := "token-1"
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer apiServer.Close()
+
+	target := Target{
+		Name:       "staging",
+		URL:        apiServer.URL,
+		AuthScheme: AuthSchemeOAuth2,
+		TokenURL:   tokenServer.URL,
+		ClientID:   "redgen",
+		Token:      "secret",
+		Scopes:     []string{"readings:write"},
+	}
+	profile := CreateDefaultProfile("")
+	profile, err := GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(30*time.Minute))
+	assert.NoError(t, err)
+
+	service, err := NewLibrarianService(target)
+	assert.NoError(t, err)
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, issued)
+
+	// the token is shared by the next services of the target
+	service, err = NewLibrarianService(target)
+	assert.NoError(t, err)
+	err = postAllReadings(service, profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, issued)
+
+	// the API revoked the token, a new one is requested once
+	validToken = "token-2"
+	err = postAllReadings(service, profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, issued)
+}
+
+// postAllReadings posts the readings of the profile whatever the watermark
+func postAllReadings(s *LibrarianService, p Profile) error {
+	body, err := s.BuildDocument(p, p.Readings)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.post(body, "")
+	return err
+}
+
+func TestTokenExpiryFromJWT(t *testing.T) {
+	exp := time.Date(2026, 10, 18, 12, 00, 00, 00, time.UTC)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"redgen","exp":%d}`, exp.Unix())))
+	expiry := tokenExpiry(tokenResponse{AccessToken: "header." + payload + ".signature"})
+	assert.Equal(t, exp.Unix(), expiry.Unix())
+}
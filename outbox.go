@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	defaultOutboxPath  = filepath.Join(".", "outbox")
+	deadLetterFileName = "dead_letter.jsonl"
+)
+
+// default delays between two attempts to deliver a payload of the outbox
+const (
+	defaultRetryBaseDelay = 30 * time.Second
+	defaultRetryMaxDelay  = time.Hour
+)
+
+// OutboxEntry is a payload the API did not accept yet, along with the idempotency keys of its readings
+type OutboxEntry struct {
+	ID          string    `json:"id"`
+	Body        string    `json:"body"`
+	Keys        []string  `json:"keys,omitempty"`
+	Attempts    int       `json:"attempts"`
+	CreatedAt   time.Time `json:"createdAt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	HeldBy      string    `json:"heldBy,omitempty"`
+}
+
+// DeadLetter is a payload the API rejected, it is never sent again
+type DeadLetter struct {
+	Entry        OutboxEntry `json:"entry"`
+	StatusCode   int         `json:"statusCode"`
+	ResponseBody string      `json:"responseBody,omitempty"`
+	RejectedAt   time.Time   `json:"rejectedAt"`
+}
+
+// Outbox is an on-disk queue of the payloads of a profile waiting to be delivered.
+// Every payload is stored in its own file, named so that the files sort in the order they were queued.
+type Outbox struct {
+	Path string
+}
+
+func NewOutbox(path string) *Outbox {
+	return &Outbox{Path: path}
+}
+
+// ProfileOutbox returns the outbox of the profile stored in the given file for the given sink
+func ProfileOutbox(filename string, sink string) *Outbox {
+	return NewOutbox(filepath.Join(defaultOutboxPath, strings.TrimSuffix(filename, filepath.Ext(filename)), sink))
+}
+
+// outboxSequence tells apart the entries queued at the same time, whichever outbox they are queued in
+var outboxSequence uint64
+
+// Enqueue stores the payload so it is delivered on the next attempt at or after the given time
+func (o *Outbox) Enqueue(body []byte, keys []string, nextAttempt time.Time, lastError error) error {
+	entry := newOutboxEntry(body, keys, nextAttempt)
+	if lastError != nil {
+		entry.LastError = lastError.Error()
+	}
+	return o.Update(entry)
+}
+
+// Hold stores a payload the chaos mode withheld so it is delivered at or after the given time.
+// Held payloads are out of order on purpose, they do not keep the other payloads of the outbox waiting.
+func (o *Outbox) Hold(body []byte, keys []string, withheld *WithheldError, nextAttempt time.Time) error {
+	entry := newOutboxEntry(body, keys, nextAttempt)
+	entry.LastError = withheld.Error()
+	entry.HeldBy = withheld.Fault
+	return o.Update(entry)
+}
+
+func newOutboxEntry(body []byte, keys []string, nextAttempt time.Time) OutboxEntry {
+	now := clock.Now()
+	return OutboxEntry{
+		ID:          fmt.Sprintf("%019d-%06d", now.UnixNano(), atomic.AddUint64(&outboxSequence, 1)%1000000),
+		Body:        string(body),
+		Keys:        keys,
+		CreatedAt:   now,
+		NextAttempt: nextAttempt,
+	}
+}
+
+// Update stores the entry again, after an attempt to deliver it.
+// The entry is written to a temporary file renamed over the entry, so that a crash never leaves it half written.
+func (o *Outbox) Update(entry OutboxEntry) error {
+	jsonBytes, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(o.Path, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(o.Path, "."+entry.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(jsonBytes)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), o.entryPath(entry))
+}
+
+// Remove deletes the entry once it was delivered
+func (o *Outbox) Remove(entry OutboxEntry) error {
+	return os.Remove(o.entryPath(entry))
+}
+
+// Pending returns the entries waiting to be delivered, oldest first
+func (o *Outbox) Pending() ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+	files, err := ioutil.ReadDir(o.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fileBytes, err := ioutil.ReadFile(filepath.Join(o.Path, name))
+		if err != nil {
+			return nil, err
+		}
+		entry := OutboxEntry{}
+		err = json.Unmarshal(fileBytes, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("the outbox entry %s is corrupted: %s", name, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// DeadLetter removes the entry from the queue and appends it to the dead letter file of the outbox
+func (o *Outbox) DeadLetter(entry OutboxEntry, statusCode int, responseBody []byte) error {
+	deadLetter := DeadLetter{
+		Entry:        entry,
+		StatusCode:   statusCode,
+		ResponseBody: string(responseBody),
+		RejectedAt:   clock.Now(),
+	}
+	jsonBytes, err := json.Marshal(deadLetter)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(o.Path, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	deadLetterFile, err := os.OpenFile(filepath.Join(o.Path, deadLetterFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer deadLetterFile.Close()
+	_, err = deadLetterFile.Write(append(jsonBytes, '\n'))
+	if err != nil {
+		return err
+	}
+	err = o.Remove(entry)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (o *Outbox) entryPath(entry OutboxEntry) string {
+	return filepath.Join(o.Path, entry.ID+".json")
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+// The delay doubles with every attempt up to the maximum, and a random jitter
+// of up to half the delay spreads the retries of many profiles.
+func Backoff(attempts int, baseDelay time.Duration, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay - jitter
+}
+
+// RetryAfter reads the Retry-After header of the response, given either in seconds or as a date
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(time.Now()), true
+	}
+	return 0, false
+}
+
+// IsPermanentFailure tells if the API rejected the payload, so sending it again would not help.
+// Requests timing out or being throttled are retried like server errors, and so are requests refused
+// for their credentials, as the payload goes through once the token is renewed.
+func IsPermanentFailure(statusCode int) bool {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return statusCode >= 400 && statusCode < 500
+}
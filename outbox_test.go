@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempts := 1; attempts < 10; attempts++ {
+		delay := Backoff(attempts, time.Second, time.Minute)
+		expected := time.Second << uint(attempts-1)
+		if expected > time.Minute {
+			expected = time.Minute
+		}
+		assert.True(t, delay <= expected, "attempt %d waits %s", attempts, delay)
+		assert.True(t, delay >= expected/2, "attempt %d waits %s", attempts, delay)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	_, ok := RetryAfter(resp)
+	assert.False(t, ok)
+
+	resp.Header.Set("Retry-After", "120")
+	delay, ok := RetryAfter(resp)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+}
+
+func TestOutboxKeepsEntriesQueuedAtTheSameTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock = NewSteppingClock(start)
+	defer func() { clock = realClock{} }()
+
+	outbox := NewOutbox(dir)
+	for _, body := range []string{"first", "second", "third"} {
+		assert.NoError(t, outbox.Enqueue([]byte(body), nil, start, nil))
+	}
+	entries, err := outbox.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "first", entries[0].Body)
+	assert.Equal(t, "third", entries[2].Body)
+
+	// entries are replaced as a whole, no temporary file is left behind
+	entries[0].Attempts = 2
+	assert.NoError(t, outbox.Update(entries[0]))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	entries, err = outbox.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, entries[0].Attempts)
+}
+
+func TestRefusedCredentialsAreRetried(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statusCodes := []int{http.StatusUnauthorized, http.StatusCreated}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statusCodes[requests])
+		requests++
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(15*time.Minute))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL, Token: "expired"})
+	assert.NoError(t, err)
+	service.Outbox = NewOutbox(dir)
+
+	// the token was refused, the reading waits in the outbox rather than in the dead letter file
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	entries, err := service.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	pending, err := service.FlushOutbox()
+	assert.NoError(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, 2, requests)
+	_, err = os.Stat(filepath.Join(dir, deadLetterFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.False(t, IsPermanentFailure(http.StatusForbidden))
+	assert.True(t, IsPermanentFailure(http.StatusUnprocessableEntity))
+}
+
+func TestSendReadingsActionWithOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statusCodes := []int{http.StatusServiceUnavailable, http.StatusCreated, http.StatusUnprocessableEntity, http.StatusCreated}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statusCodes[requests])
+		requests++
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(45*time.Minute))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL})
+	assert.NoError(t, err)
+	service.Outbox = NewOutbox(dir)
+
+	// the API is down, the first reading and the ones behind it are queued
+	profile, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Empty(t, profile.UnsentReadings("dev"))
+	entries, err := service.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	// the outbox is delivered in order, the rejected reading goes to the dead letter file
+	pending, err := service.FlushOutbox()
+	assert.NoError(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, 4, requests)
+	entries, err = service.Outbox.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	deadLetters, err := ioutil.ReadFile(filepath.Join(dir, deadLetterFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(deadLetters), `"statusCode":422`)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -18,6 +19,12 @@ import (
 
 const DefaultProfile = "DefaultProfile"
 
+// policies for the readings missed while the generator was not running
+const (
+	CatchUpIntervals = "intervals" // a reading for every missed interval
+	CatchUpLumpSum   = "lump"      // a single reading holding the consumption of all missed intervals
+)
+
 var (
 	defaultProfilePath  = filepath.Join(".", "profiles")
 	defaultReadingsPath = filepath.Join(".", "readings")
@@ -28,16 +35,34 @@ var (
 )
 
 type Profile struct {
-	Name                 string             `json:"name"`
-	BaseDailyConsumption float64            `json:"baseDailyConsumption"`
-	HourlyProfiles       map[string]float64 `json:"hourlyProfiles"`
-	WeeklyProfiles       map[string]float64 `json:"weeklyProfiles"`
-	MonthlyProfiles      map[string]float64 `json:"monthlyProfiles"`
-	Variability          float64            `json:"variability"`
-	Unit                 string             `json:"unit"`
-	Interval             float64            `json:"interval"`
-	Start                time.Time          `json:"startAt"`
-	Readings             []Reading          `json:"readings"`
+	Name                 string               `json:"name"`
+	BaseDailyConsumption float64              `json:"baseDailyConsumption"`
+	HourlyProfiles       map[string]float64   `json:"hourlyProfiles"`
+	WeeklyProfiles       map[string]float64   `json:"weeklyProfiles"`
+	MonthlyProfiles      map[string]float64   `json:"monthlyProfiles"`
+	DayCurves            []DayCurve           `json:"dayCurves,omitempty"`
+	Holidays             []string             `json:"holidays,omitempty"`
+	HolidayCalendar      *HolidayCalendar     `json:"holidayCalendar,omitempty"`
+	Interpolation        string               `json:"interpolation,omitempty"`
+	Variability          float64              `json:"variability"`
+	Noise                *NoiseModel          `json:"noise,omitempty"`
+	NoiseState           float64              `json:"noiseState,omitempty"`
+	Unit                 string               `json:"unit"`
+	Interval             float64              `json:"interval"`
+	Start                time.Time            `json:"startAt"`
+	Timezone             string               `json:"timezone,omitempty"`
+	Seed                 int64                `json:"seed,omitempty"`
+	CatchUp              string               `json:"catchUp,omitempty"`
+	MeterId              string               `json:"meterId,omitempty"`
+	Target               string               `json:"target,omitempty"`
+	Sinks                []string             `json:"sinks,omitempty"`
+	Acknowledged         map[string]time.Time `json:"acknowledged,omitempty"`
+	Anomalies            []Anomaly            `json:"anomalies,omitempty"`
+	Labels               []AnomalyLabel       `json:"labels,omitempty"`
+	RegisterDigits       int                  `json:"registerDigits,omitempty"`
+	Resolution           float64              `json:"resolution,omitempty"`
+	Register             *float64             `json:"register,omitempty"`
+	Readings             []Reading            `json:"readings"`
 }
 
 type Start struct {
@@ -93,27 +118,136 @@ func (p Profile) SetBaseDailyConsumption(baseConsumption float64) {
 
 // StartAt mocks a clock based on the configuration file (Year,Month, Day and Hour are configurable)
 // The clock will always start in the current year(if the year is not set), day 1, in 0 minutes, seconds and nseconds.
+// The time returned is in the time zone of the profile, so that the readings generated from it carry its offset.
 func (p Profile) StartAt() (time.Time, float64, error) {
 	var (
 		state float64
-		date  time.Time
-		err   error
 		count = len(p.Readings)
 	)
 
+	location, err := p.Location()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	next := p.localStart(location)
 	if count != 0 {
 		state = p.Readings[count-1].State
-		lastWriteTime := p.Readings[count-1].Time
-		if err != nil {
-			log.Fatal(err.Error())
+		if p.Register != nil {
+			// the readings only show the register, the exact state goes on behind them
+			state = *p.Register
+		}
+		lastWriteTime := p.Readings[count-1].Time.In(location)
+		next = lastWriteTime.Add(time.Minute * time.Duration(p.Interval))
+	}
+	// the last intervals may have been left without a reading by an anomaly
+	if labelled := p.lastLabelledInterval(); !labelled.IsZero() && !labelled.Before(next) {
+		next = labelled.In(location).Add(time.Minute * time.Duration(p.Interval))
+	}
+	// readings are taken on the boundaries of the interval, like a profile scheduled by the generator
+	interval := time.Minute * time.Duration(p.Interval)
+	if interval > 0 && boundaryIn(next, interval, location).Before(next) {
+		next = nextBoundaryIn(next, interval, location)
+	}
+	return next, state, nil
+}
+
+// NewRand returns the random source of the reading at the given date.
+// Without a seed the source is seeded from the clock. With a seed, the source is mixed
+// from the seed and the time of the reading, so that every reading draws the same values
+// whether the profile was generated in one run or resumed from its readings file.
+func (p Profile) NewRand(date time.Time) *rand.Rand {
+	if p.Seed == 0 {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(rand.NewSource(int64(splitMix64(splitMix64(uint64(p.Seed)) ^ uint64(date.UnixNano())))))
+}
+
+// splitMix64 scrambles the bits of x, so that close seeds and times give unrelated sources
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// MeterID identifies the meter of the profile for the API, it defaults to the sanitized name of the profile
+func (p Profile) MeterID() string {
+	if p.MeterId != "" {
+		return p.MeterId
+	}
+	return SanitizeName(p.Name)
+}
+
+// UnsentReadings returns the readings after the last reading the given sink acknowledged
+func (p Profile) UnsentReadings(sink string) []Reading {
+	acknowledged, ok := p.Acknowledged[sink]
+	if !ok {
+		return p.Readings
+	}
+	for i, reading := range p.Readings {
+		if reading.Time.After(acknowledged) {
+			return p.Readings[i:]
 		}
-		lastWriteTime = lastWriteTime.Add(time.Minute * time.Duration(p.Interval))
-		return lastWriteTime, state, nil
-	} else {
-		return p.Start, state, nil
 	}
+	return nil
+}
+
+// Acknowledge moves the watermark of the sink to the given reading,
+// the readings up to it are not delivered to the sink again
+func (p *Profile) Acknowledge(sink string, reading Reading) {
+	acknowledged := make(map[string]time.Time, len(p.Acknowledged)+1)
+	for name, watermark := range p.Acknowledged {
+		acknowledged[name] = watermark
+	}
+	acknowledged[sink] = reading.Time
+	p.Acknowledged = acknowledged
+}
+
+// ApplySeed overrides the seed of the profile when a seed was given on the command line
+func (p *Profile) ApplySeed(seed int64) {
+	if seed != 0 {
+		p.Seed = seed
+	}
+}
+
+// NextReading creates the reading for the given date on top of the previous state,
+// using the hourly (or day curve), weekly and monthly factors that apply to the date in the time zone it carries,
+// as steps or interpolated at the middle of the interval the reading stands for. Dates are added in absolute time,
+// so a local day has 23 or 25 hours of readings on DST transitions.
+// The hourly consumption varies by the noise model of the profile, the uniform variability by default.
+func (p *Profile) NextReading(rng *rand.Rand, date time.Time, state float64) Reading {
+	sampledAt := date
+	if p.smooth() {
+		sampledAt = date.Add(time.Duration(p.Interval) * time.Minute / 2)
+	}
+	var (
+		hourBase             = p.HourFactorAt(sampledAt)
+		weekBase             = p.WeekFactor(date)
+		monthBase            = p.MonthFactorAt(sampledAt)
+		baseDailyConsumption = p.BaseDailyConsumption
+		variability          = p.Variability
+	)
+	if p.noisy() {
+		baseDailyConsumption = p.drawHourlyConsumption(rng, p.BaseDailyConsumption/24) * 24
+		variability = 0
+	}
+	return NewReading(rng, date, p.Unit, p.Interval, baseDailyConsumption, hourBase, weekBase, monthBase, variability, state)
+}
 
-	return date, state, nil
+// AppendReading generates the reading of the date on top of the state and stores the readings of its interval,
+// after the anomalies hitting it and as shown by the register of the profile, if any.
+// It returns the exact state the next reading continues from.
+func (p *Profile) AppendReading(rng *rand.Rand, date time.Time, state float64) float64 {
+	readings, next := p.applyAnomalies(rng, p.NextReading(rng, date, state), state)
+	if p.hasRegister() {
+		next = p.wrapRegister(next)
+		p.Register = &next
+		for i := range readings {
+			readings[i].State = p.ShowRegister(readings[i].State)
+		}
+	}
+	p.Readings = append(p.Readings, readings...)
+	return next
 }
 
 func WriteProfileToFile(profile Profile, path string, profileFile string) error {
@@ -128,7 +262,7 @@ func WriteProfileToFile(profile Profile, path string, profileFile string) error
 	if err != nil {
 		return err
 	}
-	return nil
+	return WriteLabelsFile(profile, filepath.Join(path, sanitizedProfileName))
 }
 
 func WriteReadingsToFile(profile Profile, profileFile string) error {
@@ -143,7 +277,7 @@ func WriteReadingsToFile(profile Profile, profileFile string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return WriteLabelsFile(profile, profileFile)
 }
 
 func NewProfileFromJson(profileBytes []byte) (Profile, error) {
@@ -187,58 +321,114 @@ func CreateDefaultProfile(name string) Profile {
 	}
 }
 
-func GenerateReadings(profile Profile, path string) {
-	var (
-		baseDailyConsumption = profile.BaseDailyConsumption
-		variability          = profile.Variability
-	)
-
+// GenerateReadings generates a reading for every interval as the clock reaches it and saves them,
+// until the given end or forever without one
+func GenerateReadings(profile Profile, path string, until time.Time) {
 	date, state, err := profile.StartAt()
 
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	for {
-		var (
-			hourBase  = profile.HourlyProfiles[date.Format("12")]
-			weekBase  = profile.WeeklyProfiles[date.Format("Mon")]
-			monthBase = profile.MonthlyProfiles[date.Format("Jan")]
-		)
-		reading := NewReading(date, profile.Unit, profile.Interval, baseDailyConsumption, hourBase, weekBase, monthBase, variability, state)
-		profile.Readings = append(profile.Readings, reading)
+	for until.IsZero() || date.Before(until) {
+		totalReadings := len(profile.Readings)
+		state = profile.AppendReading(profile.NewRand(date), date, state)
+		for _, reading := range profile.Readings[totalReadings:] {
+			PrintJSONReading(reading)
+		}
+		SaveReadings(profile, path)
+
+		date = date.Add(time.Duration(profile.Interval) * time.Minute)
+		if wait := date.Sub(clock.Now()); wait > 0 {
+			clock.Sleep(wait)
+		}
+	}
+}
 
-		PrintJSONReading(reading)
+// GenerateReadingsBetween appends a reading for every interval from the start of the period
+// until its end (exclusive), continuing from the state of the last stored reading.
+// Without a start, the period begins where the profile stopped.
+func GenerateReadingsBetween(profile Profile, from time.Time, to time.Time) (Profile, error) {
+	profile, _, _, err := generateReadingsBetween(profile, from, to)
+	return profile, err
+}
 
-		state = profile.Readings[len(profile.Readings)-1].State
-		SaveReadings(profile, path)
+// generateReadingsBetween generates the readings like GenerateReadingsBetween and also returns the exact state
+// after the last interval and the date of that interval, whether the interval got a reading or not
+func generateReadingsBetween(profile Profile, from time.Time, to time.Time) (Profile, float64, time.Time, error) {
+	err := ValidateInterval(profile)
+	if err != nil {
+		return profile, 0, time.Time{}, err
+	}
+	date, state, err := profile.StartAt()
+	if err != nil {
+		return profile, 0, time.Time{}, err
+	}
+	if !from.IsZero() {
+		if len(profile.Readings) > 0 && from.Before(date) {
+			return profile, 0, time.Time{}, fmt.Errorf("the period starts at %s, before the next reading of the profile at %s", from, date)
+		}
+		date = from.In(date.Location())
+	}
+	if !date.Before(to) {
+		return profile, 0, time.Time{}, fmt.Errorf("the period ends at %s, before it starts at %s", to, date)
+	}
 
-		time.Sleep(5 * time.Millisecond)
+	var last time.Time
+	for date.Before(to) {
+		state = profile.AppendReading(profile.NewRand(date), date, state)
+		last = date
 		date = date.Add(time.Duration(profile.Interval) * time.Minute)
 	}
+	return profile, state, last, nil
 }
 
-func GenerateSingleReading(profile Profile) Profile {
-	var (
-		baseDailyConsumption = profile.BaseDailyConsumption
-		variability          = profile.Variability
-	)
+// CatchUp generates the readings the profile missed between its last reading and now,
+// so that the state stays continuous after the generator was stopped for a while.
+// Depending on the catch up policy, every missed interval gets a reading or a single
+// reading at the last missed interval carries the consumption of all of them.
+func CatchUp(profile Profile, now time.Time) (Profile, error) {
+	date, _, err := profile.StartAt()
+	if err != nil {
+		return profile, err
+	}
+	if date.After(now) {
+		return profile, nil
+	}
+	totalReadings := len(profile.Readings)
+	profile, state, last, err := generateReadingsBetween(profile, time.Time{}, now.Add(time.Nanosecond))
+	if err != nil {
+		return profile, err
+	}
+	// the missed intervals may have got no reading at all, then there is nothing to collapse
+	if profile.CatchUp == CatchUpLumpSum && len(profile.Readings) > totalReadings {
+		lumpSum := profile.Readings[len(profile.Readings)-1]
+		lumpSum.Time = last
+		lumpSum.State = state
+		if profile.hasRegister() {
+			lumpSum.State = profile.ShowRegister(state)
+		}
+		profile.Readings = append(profile.Readings[:totalReadings], lumpSum)
+	}
+	return profile, nil
+}
+
+// ValidateCatchUp checks that the catch up policy, when set, is a known one
+func ValidateCatchUp(p Profile) error {
+	var err error
+	if p.CatchUp != "" && p.CatchUp != CatchUpIntervals && p.CatchUp != CatchUpLumpSum {
+		err = fmt.Errorf("the catch up policy %s is not valid, should be one of: [ %s, %s ]", p.CatchUp, CatchUpIntervals, CatchUpLumpSum)
+	}
+	return err
+}
 
+func GenerateSingleReading(profile Profile) Profile {
 	date, state, err := profile.StartAt()
 
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	var (
-		hourBase  = profile.HourlyProfiles[date.Format("12")]
-		weekBase  = profile.WeeklyProfiles[date.Format("Mon")]
-		monthBase = profile.MonthlyProfiles[date.Format("Jan")]
-	)
-	if len(profile.Readings) > 0 {
-		state = profile.Readings[len(profile.Readings)-1].State
-	}
-	reading := NewReading(date, profile.Unit, profile.Interval, baseDailyConsumption, hourBase, weekBase, monthBase, variability, state)
-	profile.Readings = append(profile.Readings, reading)
+	profile.AppendReading(profile.NewRand(date), date, state)
 	return profile
 }
 
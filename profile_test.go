@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestCreateProfile(t *testing.T) {
@@ -33,3 +34,120 @@ func TestSanitizeName(t *testing.T) {
 	actualResult := SanitizeName(sampleName)
 	assert.EqualValues(t, expectedResult, actualResult)
 }
+
+func TestGenerateSingleReadingIsReproducibleWithSeed(t *testing.T) {
+	generate := func(seed int64) []Reading {
+		profile := CreateDefaultProfile("")
+		profile.Seed = seed
+		for i := 0; i < 10; i++ {
+			profile = GenerateSingleReading(profile)
+		}
+		return profile.Readings
+	}
+
+	assert.Equal(t, generate(42), generate(42))
+	assert.NotEqual(t, generate(42), generate(43))
+}
+
+func TestResumedProfileDrawsTheSameValuesAsOneRun(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Seed = 42
+	end := profile.Start.Add(10 * 15 * time.Minute)
+	oneRun, err := GenerateReadingsBetween(profile, time.Time{}, end)
+	assert.NoError(t, err)
+
+	resumed, err := GenerateReadingsBetween(profile, time.Time{}, profile.Start.Add(4*15*time.Minute))
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		resumed = GenerateSingleReading(resumed)
+	}
+	resumed, err = GenerateReadingsBetween(resumed, time.Time{}, end)
+	assert.NoError(t, err)
+	assert.Equal(t, oneRun.Readings, resumed.Readings)
+
+	// the sources of close seeds and dates do not collide
+	next := profile.Start.Add(15 * time.Minute)
+	assert.NotEqual(t, Profile{Seed: 1}.NewRand(next).Int63(), Profile{Seed: 2}.NewRand(profile.Start).Int63())
+	assert.NotEqual(t, Profile{Seed: 1}.NewRand(next).Int63(), Profile{Seed: 1}.NewRand(profile.Start).Int63())
+}
+
+func TestGenerateReadingsBetween(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	from := time.Date(2017, 02, 01, 00, 00, 00, 00, time.UTC)
+	to := time.Date(2017, 02, 02, 00, 00, 00, 00, time.UTC)
+
+	profile, err := GenerateReadingsBetween(profile, from, to)
+	assert.NoError(t, err)
+	assert.Len(t, profile.Readings, 96)
+	assert.Equal(t, from, profile.Readings[0].Time)
+	assert.Equal(t, to.Add(-15*time.Minute), profile.Readings[95].Time)
+
+	// continues from the last reading without a start
+	profile, err = GenerateReadingsBetween(profile, time.Time{}, to.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, profile.Readings, 100)
+	assert.True(t, profile.Readings[96].State >= profile.Readings[95].State)
+
+	// the period cannot overlap the stored readings
+	_, err = GenerateReadingsBetween(profile, from, to.Add(2*time.Hour))
+	assert.Error(t, err)
+}
+
+func TestCatchUp(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Seed = 7
+	now := profile.Start.Add(2*time.Hour + 5*time.Minute)
+
+	caughtUp, err := CatchUp(profile, now)
+	assert.NoError(t, err)
+	assert.Len(t, caughtUp.Readings, 9)
+	assert.Equal(t, profile.Start.Add(2*time.Hour), caughtUp.Readings[8].Time)
+
+	// nothing is missed until the next interval
+	again, err := CatchUp(caughtUp, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, again.Readings, 9)
+
+	profile.CatchUp = CatchUpLumpSum
+	lumpSum, err := CatchUp(profile, now)
+	assert.NoError(t, err)
+	assert.Len(t, lumpSum.Readings, 1)
+	assert.Equal(t, caughtUp.Readings[8], lumpSum.Readings[0])
+}
+
+func TestCatchUpLumpSumWithMissingReadings(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Seed = 7
+	profile.CatchUp = CatchUpLumpSum
+	at := func(intervals int) time.Time {
+		return profile.Start.Add(time.Duration(intervals) * 15 * time.Minute)
+	}
+
+	// every missed interval is missing, there is no reading to collapse
+	allMissing := profile
+	allMissing.Anomalies = []Anomaly{{Type: AnomalyMissing, From: at(0), To: at(4)}}
+	caughtUp, err := CatchUp(allMissing, at(3))
+	assert.NoError(t, err)
+	assert.Empty(t, caughtUp.Readings)
+
+	// the consumption of the last intervals, missing, still shows in the lump sum at the last interval
+	profile, err = GenerateReadingsBetween(profile, profile.Start, at(2))
+	assert.NoError(t, err)
+	profile.Anomalies = []Anomaly{{Type: AnomalyMissing, From: at(6), To: at(9)}}
+	intervals := profile
+	intervals.CatchUp = CatchUpIntervals
+	intervals, err = CatchUp(intervals, at(8))
+	assert.NoError(t, err)
+	assert.Len(t, intervals.Readings, 6)
+	lumpSum, err := CatchUp(profile, at(8))
+	assert.NoError(t, err)
+	assert.Len(t, lumpSum.Readings, 3)
+	assert.Equal(t, at(8), lumpSum.Readings[2].Time)
+	assert.True(t, lumpSum.Readings[2].State > intervals.Readings[5].State)
+
+	// missed intervals all missing after stored readings leave the readings as they are
+	profile.Anomalies = []Anomaly{{Type: AnomalyMissing, From: at(2), To: at(9)}}
+	stored, err := CatchUp(profile, at(8))
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Readings, stored.Readings)
+}
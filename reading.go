@@ -16,14 +16,14 @@ type Reading struct {
 	Suit    string    `json:"suit,omitempty"`
 }
 
-func NewReading(date time.Time, unit string, interval, baseDailyConsumption, hourBase, weekBase, monthBase, variability, state float64) Reading {
+func NewReading(rng *rand.Rand, date time.Time, unit string, interval, baseDailyConsumption, hourBase, weekBase, monthBase, variability, state float64) Reading {
 	baseDailyConsumptionDiv := baseDailyConsumption / 24 // 24 hours in a day
 	var currentHour float64
 
 	if variability > 0 {
 		hourLowerBound := baseDailyConsumptionDiv - (variability / 10)
 		hourUpperBound := baseDailyConsumptionDiv + (variability / 10)
-		currentHour = RandomFloat64(hourLowerBound, hourUpperBound)
+		currentHour = RandomFloat64(rng, hourLowerBound, hourUpperBound)
 	} else {
 		currentHour = baseDailyConsumptionDiv
 	}
@@ -44,14 +44,15 @@ func PrintJSONReading(reading Reading) {
 	fmt.Println(string(jsonBytes))
 }
 
-func RandomFloat64(lo float64, hi float64) float64 {
-	rand.Seed(time.Now().UnixNano())
+// RandomFloat64 draws a number between lo and hi from the given source,
+// so that callers holding a seeded source get reproducible values
+func RandomFloat64(rng *rand.Rand, lo float64, hi float64) float64 {
 	lowerBound := int(lo * 10000000)
 	upperBound := int(hi * 10000000)
 	boundDifference := upperBound - lowerBound
 	if boundDifference < 0 {
 		boundDifference = 0
 	}
-	randomNumber := rand.Intn(boundDifference) + lowerBound
+	randomNumber := rng.Intn(boundDifference) + lowerBound
 	return float64(randomNumber) / 10000000
 }
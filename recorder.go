@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordedRequest is a request sent to an API target. The credentials of the Authorization header are not recorded.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// RecordedResponse is the response of the API to a recorded request
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Exchange is a request sent to an API target along with its response,
+// or the error that kept the request from getting a response
+type Exchange struct {
+	ID         string            `json:"id"`
+	Sink       string            `json:"sink"`
+	RecordedAt time.Time         `json:"recordedAt"`
+	Duration   string            `json:"duration"`
+	Request    RecordedRequest   `json:"request"`
+	Response   *RecordedResponse `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Recorder writes every exchange with the API to its own JSON file in a directory.
+// The files are named so that they sort in the order the requests were sent.
+type Recorder struct {
+	Dir string
+
+	mu       sync.Mutex
+	sequence int
+}
+
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{Dir: dir}
+}
+
+// Record stores the exchange, the request body is given apart as the body of the request was already read
+func (r *Recorder) Record(sink string, req *http.Request, body []byte, sentAt time.Time, resp *http.Response, respBody []byte, sendErr error) error {
+	r.mu.Lock()
+	r.sequence++
+	exchange := Exchange{
+		ID:         fmt.Sprintf("%s-%06d", sentAt.UTC().Format("20060102T150405.000000000Z"), r.sequence),
+		Sink:       sink,
+		RecordedAt: sentAt,
+		Duration:   time.Since(sentAt).String(),
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+			Body:   string(body),
+		},
+	}
+	r.mu.Unlock()
+	if resp != nil {
+		exchange.Response = &RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       string(respBody),
+		}
+	}
+	if sendErr != nil {
+		exchange.Error = sendErr.Error()
+	}
+	jsonBytes, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(r.Dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(r.Dir, exchange.ID+".json"), jsonBytes, 0644)
+}
+
+// redactHeader keeps the scheme of the Authorization header only
+func redactHeader(header http.Header) http.Header {
+	redacted := http.Header{}
+	for name, values := range header {
+		redacted[name] = values
+	}
+	if authorization := header.Get("Authorization"); authorization != "" {
+		redacted.Set("Authorization", strings.SplitN(authorization, " ", 2)[0]+" [redacted]")
+	}
+	return redacted
+}
+
+// LoadExchanges reads the exchanges recorded in the directory, in the order they were sent
+func LoadExchanges(dir string) ([]Exchange, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	var exchanges []Exchange
+	for _, name := range names {
+		fileBytes, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		exchange := Exchange{}
+		err = json.Unmarshal(fileBytes, &exchange)
+		if err != nil {
+			return nil, fmt.Errorf("the recorded exchange %s is corrupted: %s", name, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, nil
+}
+
+// PlaybackResult compares the recorded response of an exchange to the response of the target it was played back to
+type PlaybackResult struct {
+	Exchange Exchange
+	Response *RecordedResponse
+	Error    string
+	Diff     string
+}
+
+// Differs tells if the target did not answer like the recorded response
+func (r PlaybackResult) Differs() bool {
+	return r.Diff != ""
+}
+
+// CmdPlaybackAction sends the requests recorded in the directory to the target and reports the responses that differ
+func CmdPlaybackAction(dir string, targetName string) (string, error) {
+	config, err := LoadConfig(*redgenConfigFile)
+	if err != nil {
+		return "", err
+	}
+	target, err := config.TargetFor(Profile{})
+	if targetName != "" {
+		target, err = config.Target(targetName)
+	}
+	if err != nil {
+		return "", err
+	}
+	service, err := NewLibrarianService(target)
+	if err != nil {
+		return "", err
+	}
+	exchanges, err := LoadExchanges(dir)
+	if err != nil {
+		return "", err
+	}
+	differing := 0
+	for _, result := range Playback(exchanges, service) {
+		if !result.Differs() {
+			continue
+		}
+		differing++
+		fmt.Printf("%s %s %s\n%s\n", result.Exchange.ID, result.Exchange.Request.Method, result.Exchange.Request.URL, result.Diff)
+	}
+	return fmt.Sprintf("%d requests played back to %s, %d responses differ", len(exchanges), target.URL, differing), nil
+}
+
+// Playback sends the recorded requests to the service in order, with the credentials and headers of the service,
+// and diffs the status and body of every response against the recorded one
+func Playback(exchanges []Exchange, service *LibrarianService) []PlaybackResult {
+	results := make([]PlaybackResult, len(exchanges))
+	for i, exchange := range exchanges {
+		result := PlaybackResult{Exchange: exchange}
+		resp, respBody, err := service.post([]byte(exchange.Request.Body), exchange.Request.Header.Get(HeaderIdempotencyKey))
+		if resp != nil {
+			result.Response = &RecordedResponse{
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+				Header:     resp.Header,
+				Body:       string(respBody),
+			}
+		} else if err != nil {
+			result.Error = err.Error()
+		}
+		result.Diff = diffResponses(exchange, result)
+		results[i] = result
+	}
+	return results
+}
+
+// diffResponses returns a unified diff of the recorded and played back responses, empty when they match.
+// JSON bodies are compared once indented, so that a different formatting is not a difference.
+func diffResponses(exchange Exchange, result PlaybackResult) string {
+	recorded := describeResponse(exchange.Response, exchange.Error)
+	played := describeResponse(result.Response, result.Error)
+	if recorded == played {
+		return ""
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(recorded),
+		B:        difflib.SplitLines(played),
+		FromFile: "recorded",
+		ToFile:   "playback",
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Sprintf("--- recorded\n%s\n+++ playback\n%s\n", recorded, played)
+	}
+	return diff
+}
+
+func describeResponse(response *RecordedResponse, sendErr string) string {
+	if response == nil {
+		return "error: " + sendErr + "\n"
+	}
+	body := response.Body
+	var indented bytes.Buffer
+	if json.Indent(&indented, []byte(body), "", "  ") == nil {
+		body = indented.String()
+	}
+	return fmt.Sprintf("status: %d\n%s\n", response.StatusCode, body)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRecordAndPlayback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-record")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recorded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"data":{"id":"1"}}`)
+	}))
+	defer recorded.Close()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(30*time.Minute))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: recorded.URL, Token: "secret"})
+	assert.NoError(t, err)
+	service.Recorder = NewRecorder(dir)
+	_, err = service.sendReadingsAction(profile)
+	assert.NoError(t, err)
+
+	exchanges, err := LoadExchanges(dir)
+	assert.NoError(t, err)
+	assert.Len(t, exchanges, 2)
+	assert.Equal(t, "dev", exchanges[0].Sink)
+	assert.Equal(t, http.MethodPost, exchanges[0].Request.Method)
+	assert.Equal(t, "Bearer [redacted]", exchanges[0].Request.Header.Get("Authorization"))
+	assert.Equal(t, IdempotencyKey(profile.Name, profile.MeterID(), profile.Readings[0]), exchanges[0].Request.Header.Get(HeaderIdempotencyKey))
+	assert.Contains(t, exchanges[0].Request.Body, `"type":"readings"`)
+	assert.Equal(t, http.StatusCreated, exchanges[0].Response.StatusCode)
+
+	var playedKeys []string
+	playback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer other", r.Header.Get("Authorization"))
+		playedKeys = append(playedKeys, r.Header.Get(HeaderIdempotencyKey))
+		if len(playedKeys) == 2 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"errors":[{"title":"Invalid state"}]}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{ "data": { "id": "1" } }`)
+	}))
+	defer playback.Close()
+
+	other, err := NewLibrarianService(Target{Name: "other", URL: playback.URL, Token: "other"})
+	assert.NoError(t, err)
+	results := Playback(exchanges, other)
+	assert.Len(t, results, 2)
+	assert.False(t, results[0].Differs())
+	assert.True(t, results[1].Differs())
+	assert.Contains(t, results[1].Diff, "-status: 201")
+	assert.Contains(t, results[1].Diff, "+status: 422")
+	assert.Equal(t, exchanges[1].Request.Header.Get(HeaderIdempotencyKey), playedKeys[1])
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// maximum number of digits of a register, more would go past the precision of the state
+const maxRegisterDigits = 15
+
+// hasRegister tells if the readings of the profile show a physical register rather than the exact state
+func (p Profile) hasRegister() bool {
+	return p.RegisterDigits > 0 || p.Resolution > 0
+}
+
+// registerResolution is the smallest step the register shows, a unit of the profile by default
+func (p Profile) registerResolution() float64 {
+	if p.Resolution > 0 {
+		return p.Resolution
+	}
+	return 1
+}
+
+// RegisterCapacity returns the state at which the register rolls over to zero: a register of 6 digits
+// with a resolution of 0.01 shows 0000.00 to 9999.99 and rolls over at 10000. A register without digits never rolls over.
+func (p Profile) RegisterCapacity() float64 {
+	if p.RegisterDigits <= 0 {
+		return math.Inf(1)
+	}
+	return math.Pow(10, float64(p.RegisterDigits)) * p.registerResolution()
+}
+
+// wrapRegister rolls the exact state over once it goes past the capacity of the register
+func (p Profile) wrapRegister(state float64) float64 {
+	capacity := p.RegisterCapacity()
+	if math.IsInf(capacity, 1) {
+		return state
+	}
+	return math.Mod(state, capacity)
+}
+
+// ShowRegister returns what the register shows for the exact state: the state rolled over and cut down to the resolution,
+// as a meter only moves to the next step once the step was fully consumed
+func (p Profile) ShowRegister(state float64) float64 {
+	state = p.wrapRegister(state)
+	resolution := p.registerResolution()
+	steps := math.Floor(state/resolution + 1e-9)
+	decimals := math.Max(0, math.Ceil(-math.Log10(resolution)))
+	scale := math.Pow(10, decimals)
+	return math.Round(steps*resolution*scale) / scale
+}
+
+// ValidateRegister checks that the register has a number of digits the state can hold and a positive resolution
+func ValidateRegister(p Profile) error {
+	if p.RegisterDigits < 0 || p.RegisterDigits > maxRegisterDigits {
+		return fmt.Errorf("the register can have at most %d digits, got %d", maxRegisterDigits, p.RegisterDigits)
+	}
+	if p.Resolution < 0 {
+		return fmt.Errorf("the resolution of the register must be positive, got %v", p.Resolution)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestShowRegister(t *testing.T) {
+	profile := Profile{RegisterDigits: 6, Resolution: 0.01}
+	assert.Equal(t, 10000.0, profile.RegisterCapacity())
+	assert.Equal(t, 1234.56, profile.ShowRegister(1234.5678))
+	assert.Equal(t, 9999.99, profile.ShowRegister(9999.996))
+	assert.Equal(t, 0.0, profile.ShowRegister(10000.004))
+	assert.Equal(t, 12.34, profile.ShowRegister(10012.345))
+
+	assert.Equal(t, 123.0, Profile{Resolution: 1}.ShowRegister(123.9))
+	assert.True(t, math.IsInf(Profile{Resolution: 1}.RegisterCapacity(), 1))
+	// without a resolution the register shows whole units
+	assert.Equal(t, 23.0, Profile{RegisterDigits: 2}.ShowRegister(123.5))
+	assert.Equal(t, 12.0, Profile{RegisterDigits: 6}.ShowRegister(12.7))
+}
+
+func TestRegisterRollsOverAndKeepsExactState(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Seed = 3
+	profile.RegisterDigits = 2
+	profile.Resolution = 0.1
+	assert.NoError(t, profile.Validate())
+
+	// every reading consumes less than the resolution, the register still moves on
+	for i := 0; i < 200; i++ {
+		profile = GenerateSingleReading(profile)
+	}
+	rolledOver := false
+	for i, reading := range profile.Readings {
+		steps := reading.State / profile.Resolution
+		assert.InDelta(t, math.Round(steps), steps, 1e-6)
+		assert.True(t, reading.State < 10)
+		if i > 0 && reading.State < profile.Readings[i-1].State {
+			rolledOver = true
+		}
+	}
+	assert.True(t, rolledOver)
+
+	exact := CreateDefaultProfile("")
+	exact.Seed = 3
+	for i := 0; i < 200; i++ {
+		exact = GenerateSingleReading(exact)
+	}
+	total := exact.Readings[len(exact.Readings)-1].State
+	assert.True(t, total > 10)
+	assert.InDelta(t, math.Mod(total, 10), *profile.Register, 1e-6)
+	assert.Equal(t, profile.ShowRegister(total), profile.Readings[len(profile.Readings)-1].State)
+
+	profile.RegisterDigits = 16
+	assert.Error(t, ValidateRegister(profile))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var defaultReplayPath = filepath.Join(".", "replay")
+
+// ReplayOptions selects the readings a replay sends.
+// Readings before From or from To on are left out when the dates are set.
+type ReplayOptions struct {
+	From     time.Time
+	To       time.Time
+	Resume   bool
+	Position string
+}
+
+// ReplayPosition is stored after every reading a replay sent, so that an interrupted replay can resume after it
+type ReplayPosition struct {
+	LastReading time.Time `json:"lastReading"`
+	Replayed    int       `json:"replayed"`
+	Total       int       `json:"total"`
+}
+
+// ReplayPositionPath returns the file storing how far the replay of the readings file to the target went
+func ReplayPositionPath(filename string, target string) string {
+	return filepath.Join(defaultReplayPath, strings.TrimSuffix(filename, filepath.Ext(filename)), target+".json")
+}
+
+// CmdReplayAction sends every reading of the readings file to the target (the target of the profile when not set)
+// in order, spaced by their original times divided by the speed
+func CmdReplayAction(filename string, speed float64, from string, to string, targetName string, resume bool) (string, error) {
+	options := ReplayOptions{Resume: resume}
+	var err error
+	clock, err = NewClock(speed, time.Time{}, time.Time{}, false)
+	if err != nil {
+		return "", err
+	}
+	if from != "" {
+		options.From, err = ParseDate(from)
+		if err != nil {
+			return "", err
+		}
+	}
+	if to != "" {
+		options.To, err = ParseDate(to)
+		if err != nil {
+			return "", err
+		}
+	}
+	profile, err := GetProfileFromJson(filepath.Join(defaultReadingsPath, filename))
+	if err != nil {
+		return "", err
+	}
+	config, err := LoadConfig(*redgenConfigFile)
+	if err != nil {
+		return "", err
+	}
+	target, err := config.TargetFor(profile)
+	if targetName != "" {
+		target, err = config.Target(targetName)
+	}
+	if err != nil {
+		return "", err
+	}
+	service, err := NewLibrarianService(target)
+	if err != nil {
+		return "", err
+	}
+	options.Position = ReplayPositionPath(filename, target.Name)
+	replayed, err := ReplayReadings(profile, service, options)
+	if err != nil {
+		return "", fmt.Errorf("the replay stopped after %d readings, resume it with --resume: %s", replayed, err)
+	}
+	return fmt.Sprintf("%d readings replayed to %s", replayed, target.URL), nil
+}
+
+// ReplayReadings posts the readings of the profile one by one, sleeping on the clock between two readings
+// as long as their times are apart. The position is stored after every reading.
+// It returns how many readings were replayed so far.
+func ReplayReadings(p Profile, service *LibrarianService, options ReplayOptions) (int, error) {
+	var readings []Reading
+	for _, reading := range p.Readings {
+		if !options.From.IsZero() && reading.Time.Before(options.From) {
+			continue
+		}
+		if !options.To.IsZero() && !reading.Time.Before(options.To) {
+			continue
+		}
+		readings = append(readings, reading)
+	}
+	position := ReplayPosition{Total: len(readings)}
+	if options.Resume {
+		var err error
+		position, err = LoadReplayPosition(options.Position)
+		if err != nil {
+			return 0, err
+		}
+		position.Total = len(readings)
+		for len(readings) > 0 && !readings[0].Time.After(position.LastReading) {
+			readings = readings[1:]
+		}
+	}
+	if len(readings) == 0 {
+		return position.Replayed, nil
+	}
+
+	previous := readings[0].Time
+	for _, reading := range readings {
+		clock.Sleep(reading.Time.Sub(previous))
+		previous = reading.Time
+		body, err := service.BuildDocument(p, []Reading{reading})
+		if err != nil {
+			return position.Replayed, err
+		}
+		_, _, err = service.post(body, IdempotencyKey(p.Name, p.MeterID(), reading))
+		if err != nil {
+			return position.Replayed, err
+		}
+		position.LastReading = reading.Time
+		position.Replayed++
+		if options.Position != "" {
+			err = position.Save(options.Position)
+			if err != nil {
+				return position.Replayed, err
+			}
+		}
+		fmt.Printf("replayed %d/%d readings, last at %s\n", position.Replayed, position.Total, reading.Time.Format(time.RFC3339))
+	}
+	return position.Replayed, nil
+}
+
+// LoadReplayPosition reads the position of a replay, a replay that never ran starts from the beginning
+func LoadReplayPosition(path string) (ReplayPosition, error) {
+	position := ReplayPosition{}
+	fileBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return position, nil
+	}
+	if err != nil {
+		return position, err
+	}
+	err = json.Unmarshal(fileBytes, &position)
+	if err != nil {
+		return position, fmt.Errorf("the replay position %s is corrupted: %s", path, err)
+	}
+	return position, nil
+}
+
+func (r ReplayPosition) Save(path string) error {
+	jsonBytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, jsonBytes, 0644)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayReadings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen-replay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var received []string
+	failAt := 3
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(received) == failAt {
+			failAt = -1
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, r.Header.Get(HeaderIdempotencyKey))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	profile := CreateDefaultProfile("")
+	profile.Interval = 30
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(3*time.Hour))
+	assert.NoError(t, err)
+	service, err := NewLibrarianService(Target{Name: "dev", URL: server.URL})
+	assert.NoError(t, err)
+
+	start := profile.Readings[0].Time
+	defer func(previous Clock) { clock = previous }(clock)
+	clock = NewSteppingClock(start)
+	options := ReplayOptions{
+		From:     start,
+		To:       start.Add(2*time.Hour + 30*time.Minute),
+		Position: filepath.Join(dir, "dev.json"),
+	}
+
+	// the API goes down after 3 readings, the replay stops there
+	replayed, err := ReplayReadings(profile, service, options)
+	assert.Error(t, err)
+	assert.Equal(t, 3, replayed)
+	assert.Equal(t, start.Add(90*time.Minute), clock.Now())
+
+	// the replay resumes after the last reading sent, and is spaced like the readings
+	options.Resume = true
+	replayed, err = ReplayReadings(profile, service, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, replayed)
+	assert.Equal(t, start.Add(2*time.Hour), clock.Now())
+	assert.Len(t, received, 5)
+	assert.Equal(t, IdempotencyKey(profile.Name, profile.MeterID(), profile.Readings[0]), received[0])
+
+	position, err := LoadReplayPosition(options.Position)
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayPosition{LastReading: start.Add(2 * time.Hour), Replayed: 5, Total: 5}, position)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// ScheduleProfile runs the profile from the given file like a real meter: it first catches up
+// with the current time, then wakes up on every boundary of the profile interval and
+// generates the reading for that boundary. Boundaries are counted from the local midnight
+// of the profile, so a profile with a 15 minutes interval runs at :00, :15, :30 and :45.
+// The time is told by the clock of the generator and the profile stops after the end of the run, if any.
+// A due profile waits for a free worker of the pool of the run before it is processed.
+func ScheduleProfile(filename string, options StartOptions) {
+	next := clock.Now()
+	for options.Until.IsZero() || !next.After(options.Until) {
+		if wait := next.Sub(clock.Now()); wait > 0 {
+			clock.Sleep(wait)
+		}
+		var profile Profile
+		options.Pool.Run(func() {
+			profile = ProcessProfile(filename, next, options)
+		})
+		next = NextBoundary(profile, clock.Now())
+		log.Printf("next reading of %s is due at %s", filename, next)
+	}
+}
+
+// NextBoundary returns when the profile is due after the given time, which is the first boundary
+// of its interval after the time. A profile that fell behind catches up on that boundary.
+func NextBoundary(profile Profile, after time.Time) time.Time {
+	location, err := profile.Location()
+	if err != nil {
+		location = time.UTC
+	}
+	return nextBoundaryIn(after, time.Duration(profile.Interval)*time.Minute, location)
+}
+
+// boundaryIn returns the last boundary of the interval at or before the time,
+// boundaries starting over at every midnight of the location
+func boundaryIn(at time.Time, interval time.Duration, location *time.Location) time.Time {
+	at = at.In(location)
+	midnight := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, location)
+	return midnight.Add(at.Sub(midnight).Truncate(interval))
+}
+
+// nextBoundaryIn returns the first boundary of the interval after the time, the next midnight at the latest
+func nextBoundaryIn(after time.Time, interval time.Duration, location *time.Location) time.Time {
+	next := boundaryIn(after, interval, location).Add(interval)
+	after = after.In(location)
+	if midnight := time.Date(after.Year(), after.Month(), after.Day()+1, 0, 0, 0, 0, location); next.After(midnight) {
+		return midnight
+	}
+	return next
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNextBoundary(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	now := profile.Start.Add(40 * time.Minute)
+
+	profile, err := CatchUp(profile, now)
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Start.Add(45*time.Minute), NextBoundary(profile, now))
+
+	// a profile which fell behind waits for the next boundary as well
+	assert.Equal(t, now.Add(5*time.Minute), NextBoundary(CreateDefaultProfile(""), now))
+	assert.Equal(t, now.Add(20*time.Minute), NextBoundary(profile, now.Add(5*time.Minute)))
+}
+
+func TestBoundariesFollowTheWallClock(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Start = time.Date(2017, 1, 1, 0, 7, 0, 0, time.UTC)
+	profile.Interval = 7
+
+	// a start between boundaries takes its first reading on the next boundary
+	next, _, err := profile.StartAt()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 1, 1, 0, 7, 0, 0, time.UTC), next)
+	profile.Interval = 15
+	next, _, err = profile.StartAt()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2017, 1, 1, 0, 15, 0, 0, time.UTC), next)
+
+	// an interval which does not divide the day starts over at midnight
+	profile.Interval = 7
+	assert.Equal(t, time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), NextBoundary(profile, time.Date(2017, 1, 1, 23, 58, 0, 0, time.UTC)))
+
+	// boundaries are counted from the local midnight
+	profile.Interval = 60
+	profile.Timezone = "Asia/Kolkata"
+	assert.Equal(t, "2017-01-01T11:00:00+05:30", NextBoundary(profile, time.Date(2017, 1, 1, 5, 0, 0, 0, time.UTC)).Format(time.RFC3339))
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// types of the sinks readings are delivered to
+const (
+	SinkTypeHTTP    = "http"
+	SinkTypeStdout  = "stdout"
+	SinkTypeFile    = "file"
+	SinkTypeWebhook = "webhook"
+)
+
+// Sink delivers the readings of a profile somewhere.
+// Every sink keeps its own watermark in the profile: Deliver sends the readings the sink
+// has not acknowledged yet and returns the profile with the watermark of the sink moved forward.
+type Sink interface {
+	SinkName() string
+	Deliver(p Profile) (Profile, error)
+}
+
+// SinkConfig describes a sink of the redgen configuration file.
+// An http sink posts to a target (the target of the profile when not set),
+// a file sink appends JSON lines to a file per profile in its path,
+// and a webhook posts the readings rendered with its template to its url.
+type SinkConfig struct {
+	Type        string            `json:"type"`
+	Target      string            `json:"target,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Method      string            `json:"method,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Template    string            `json:"template,omitempty"`
+}
+
+// SinkRecord is a reading written by the stdout and file sinks, along with the name of its profile
+type SinkRecord struct {
+	Profile string `json:"profile"`
+	Reading
+}
+
+// WebhookData is given to the template of a webhook
+type WebhookData struct {
+	Profile  string    `json:"profile"`
+	Unit     string    `json:"unit"`
+	Readings []Reading `json:"readings"`
+}
+
+// Validate checks that the sink has what its type needs
+func (s SinkConfig) Validate(c Config) error {
+	switch s.Type {
+	case SinkTypeHTTP:
+		if s.Target != "" {
+			if _, ok := c.Targets[s.Target]; !ok {
+				return fmt.Errorf("the target %s is not configured", s.Target)
+			}
+		}
+	case SinkTypeStdout:
+	case SinkTypeFile:
+		if s.Path == "" {
+			return fmt.Errorf("a file sink needs a path")
+		}
+	case SinkTypeWebhook:
+		if s.URL == "" {
+			return fmt.Errorf("a webhook needs a url")
+		}
+		if _, err := parseWebhookTemplate(s.Template); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("the type %s is not valid, should be one of: [ %s, %s, %s, %s ]",
+			s.Type, SinkTypeHTTP, SinkTypeStdout, SinkTypeFile, SinkTypeWebhook)
+	}
+	return nil
+}
+
+// SinksFor returns the sinks the readings of the profile are delivered to: the given sinks, else the sinks
+// of the profile, else the default sinks. Without any, the readings are posted to the target of the profile.
+func (c Config) SinksFor(p Profile, names []string) ([]Sink, error) {
+	if len(names) == 0 {
+		names = p.Sinks
+	}
+	if len(names) == 0 {
+		names = c.DefaultSinks
+	}
+	if len(names) == 0 {
+		service, err := c.ServiceFor(p)
+		if err != nil {
+			return nil, err
+		}
+		return []Sink{service}, nil
+	}
+	var sinks []Sink
+	for _, name := range names {
+		sink, err := c.NewSink(name, p)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// NewSink creates the sink configured with the given name for the profile
+func (c Config) NewSink(name string, p Profile) (Sink, error) {
+	sinkConfig, ok := c.Sinks[name]
+	if !ok {
+		return nil, fmt.Errorf("the sink %s is not configured", name)
+	}
+	switch sinkConfig.Type {
+	case SinkTypeHTTP:
+		target, err := c.TargetFor(p)
+		if sinkConfig.Target != "" {
+			target, err = c.Target(sinkConfig.Target)
+		}
+		if err != nil {
+			return nil, err
+		}
+		service, err := NewLibrarianService(target)
+		if err != nil {
+			return nil, err
+		}
+		service.Name = name
+		return service, nil
+	case SinkTypeStdout:
+		return &StdoutSink{Name: name}, nil
+	case SinkTypeFile:
+		return &FileSink{Name: name, Path: sinkConfig.Path}, nil
+	case SinkTypeWebhook:
+		return NewWebhookSink(name, sinkConfig)
+	}
+	return nil, fmt.Errorf("the sink %s has an unknown type %s", name, sinkConfig.Type)
+}
+
+// DeliverToSinks fans the readings of the profile out to every sink.
+// A failing sink does not stop the others, its readings are delivered again next time.
+func DeliverToSinks(p Profile, sinks []Sink) (Profile, error) {
+	var failures []string
+	for _, sink := range sinks {
+		var err error
+		p, err = sink.Deliver(p)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", sink.SinkName(), err))
+		}
+	}
+	if len(failures) > 0 {
+		return p, fmt.Errorf("could not deliver the readings to every sink: %s", strings.Join(failures, "; "))
+	}
+	return p, nil
+}
+
+// stdoutLock keeps the lines of profiles running concurrently apart
+var stdoutLock sync.Mutex
+
+// StdoutSink prints the readings as JSON lines
+type StdoutSink struct {
+	Name string
+}
+
+func (s *StdoutSink) SinkName() string {
+	return s.Name
+}
+
+func (s *StdoutSink) Deliver(p Profile) (Profile, error) {
+	readings := p.UnsentReadings(s.Name)
+	if len(readings) == 0 {
+		return p, nil
+	}
+	lines, err := jsonLines(p, readings)
+	if err != nil {
+		return p, err
+	}
+	stdoutLock.Lock()
+	_, err = os.Stdout.Write(lines)
+	stdoutLock.Unlock()
+	if err != nil {
+		return p, err
+	}
+	p.Acknowledge(s.Name, readings[len(readings)-1])
+	return p, nil
+}
+
+// FileSink appends the readings as JSON lines to a file per profile in its path
+type FileSink struct {
+	Name string
+	Path string
+}
+
+func (s *FileSink) SinkName() string {
+	return s.Name
+}
+
+func (s *FileSink) Deliver(p Profile) (Profile, error) {
+	readings := p.UnsentReadings(s.Name)
+	if len(readings) == 0 {
+		return p, nil
+	}
+	lines, err := jsonLines(p, readings)
+	if err != nil {
+		return p, err
+	}
+	err = os.MkdirAll(s.Path, os.ModePerm)
+	if err != nil {
+		return p, err
+	}
+	sinkFile, err := os.OpenFile(filepath.Join(s.Path, SanitizeName(p.Name)+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return p, err
+	}
+	defer sinkFile.Close()
+	_, err = sinkFile.Write(lines)
+	if err != nil {
+		return p, err
+	}
+	p.Acknowledge(s.Name, readings[len(readings)-1])
+	return p, nil
+}
+
+func jsonLines(p Profile, readings []Reading) ([]byte, error) {
+	var lines bytes.Buffer
+	for _, reading := range readings {
+		jsonBytes, err := json.Marshal(SinkRecord{Profile: p.Name, Reading: reading})
+		if err != nil {
+			return nil, err
+		}
+		lines.Write(jsonBytes)
+		lines.WriteByte('\n')
+	}
+	return lines.Bytes(), nil
+}
+
+// WebhookSink posts the readings rendered with a template in a single request
+type WebhookSink struct {
+	Name        string
+	URL         string
+	Method      string
+	Headers     map[string]string
+	ContentType string
+	Template    *template.Template
+}
+
+func NewWebhookSink(name string, sinkConfig SinkConfig) (*WebhookSink, error) {
+	payloadTemplate, err := parseWebhookTemplate(sinkConfig.Template)
+	if err != nil {
+		return nil, err
+	}
+	sink := &WebhookSink{
+		Name:        name,
+		URL:         sinkConfig.URL,
+		Method:      sinkConfig.Method,
+		Headers:     sinkConfig.Headers,
+		ContentType: sinkConfig.ContentType,
+		Template:    payloadTemplate,
+	}
+	if sink.Method == "" {
+		sink.Method = http.MethodPost
+	}
+	if sink.ContentType == "" {
+		sink.ContentType = "application/json"
+	}
+	return sink, nil
+}
+
+// parseWebhookTemplate parses the payload template of a webhook, which is given WebhookData.
+// The json function renders a value as JSON. Without a template, the data itself is posted as JSON.
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = "{{json .}}"
+	}
+	payloadTemplate, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			jsonBytes, err := json.Marshal(value)
+			return string(jsonBytes), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("the webhook template is not valid: %s", err)
+	}
+	return payloadTemplate, nil
+}
+
+func (s *WebhookSink) SinkName() string {
+	return s.Name
+}
+
+func (s *WebhookSink) Deliver(p Profile) (Profile, error) {
+	readings := p.UnsentReadings(s.Name)
+	if len(readings) == 0 {
+		return p, nil
+	}
+	var payload bytes.Buffer
+	err := s.Template.Execute(&payload, WebhookData{Profile: p.Name, Unit: p.Unit, Readings: readings})
+	if err != nil {
+		return p, err
+	}
+	req, err := http.NewRequest(s.Method, s.URL, &payload)
+	if err != nil {
+		return p, err
+	}
+	req.Header.Set("Content-Type", s.ContentType)
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := SendHTTPRequest(httpClient, req)
+	if err != nil {
+		return p, err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return p, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	p.Acknowledge(s.Name, readings[len(readings)-1])
+	return p, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliverToSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var payloads []string
+	webhookStatus := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		payloads = append(payloads, string(body))
+		w.WriteHeader(webhookStatus)
+	}))
+	defer server.Close()
+
+	config := Config{Sinks: map[string]SinkConfig{
+		"lake": {Type: SinkTypeFile, Path: dir},
+		"hook": {Type: SinkTypeWebhook, URL: server.URL, Template: `{"meter":"{{.Profile}}","count":{{len .Readings}}}`},
+	}}
+	assert.NoError(t, config.Validate())
+
+	profile := CreateDefaultProfile("")
+	profile.Sinks = []string{"lake", "hook"}
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(time.Hour))
+	assert.NoError(t, err)
+	sinks, err := config.SinksFor(profile, nil)
+	assert.NoError(t, err)
+	assert.Len(t, sinks, 2)
+
+	// the failing webhook does not stop the file sink
+	profile, err = DeliverToSinks(profile, sinks)
+	assert.Error(t, err)
+	assert.Empty(t, profile.UnsentReadings("lake"))
+	assert.Len(t, profile.UnsentReadings("hook"), 4)
+
+	lines, err := ioutil.ReadFile(filepath.Join(dir, "defaultprofile.jsonl"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(lines), "\n"))
+	assert.Contains(t, string(lines), `"profile":"DefaultProfile"`)
+
+	webhookStatus = http.StatusOK
+	profile, err = DeliverToSinks(profile, sinks)
+	assert.NoError(t, err)
+	assert.Empty(t, profile.UnsentReadings("hook"))
+	assert.Equal(t, `{"meter":"DefaultProfile","count":4}`, payloads[1])
+}
+
+func TestSinkConfigValidate(t *testing.T) {
+	config := Config{Targets: map[string]Target{"dev": {URL: "http://localhost"}}}
+	assert.NoError(t, SinkConfig{Type: SinkTypeHTTP, Target: "dev"}.Validate(config))
+	assert.Error(t, SinkConfig{Type: SinkTypeHTTP, Target: "staging"}.Validate(config))
+	assert.Error(t, SinkConfig{Type: SinkTypeFile}.Validate(config))
+	assert.Error(t, SinkConfig{Type: SinkTypeWebhook, URL: "http://localhost", Template: "{{"}.Validate(config))
+	assert.Error(t, SinkConfig{Type: "kafka"}.Validate(config))
+}
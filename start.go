@@ -11,6 +11,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,24 +28,30 @@ func RunAppCommands() (string, error) {
 	case redgenVersion.FullCommand():
 		return helpVersion, nil
 	case redgenConfigStart.FullCommand():
-		return InitGenerator()
+		return CmdStartAction(*redgenConfigStartSeed, *redgenConfigStartSpeed, *redgenConfigStartFrom, *redgenConfigStartTo, *redgenConfigStartStep, *redgenConfigStartSink, *redgenConfigStartRecord, *redgenConfigStartWorkers, *redgenConfigStartRate)
 	case redgenConfigGenerate.FullCommand():
 		return CmdGenerate(*redgenConfigGenerateArg)
 	case redgenConfigInit.FullCommand():
 		return CmdInit()
 	case redgenConfigPreview.FullCommand():
 		if *redgenConfigPreviewArg != "" {
-			CmdPreviewAction(*redgenConfigPreviewArg, *redgenConfigPreviewArgTime)
+			CmdPreviewAction(*redgenConfigPreviewArg, *redgenConfigPreviewArgTime, *redgenConfigPreviewSeed)
 			return "", nil
 		}
-		CmdPreviewAction(defaultProfileName, *redgenConfigPreviewArgTime)
+		CmdPreviewAction(defaultProfileName, *redgenConfigPreviewArgTime, *redgenConfigPreviewSeed)
 		return "", nil
+	case redgenConfigBackfill.FullCommand():
+		return CmdBackfillAction(*redgenConfigBackfillArg, *redgenConfigBackfillFrom, *redgenConfigBackfillTo, *redgenConfigBackfillSeed)
 	case redgenConfigSend.FullCommand():
 		if *redgenConfigSendArg != "" {
-			CmdSendReadingsToServer(*redgenConfigSendArg)
+			CmdSendReadingsToServer(*redgenConfigSendArg, *redgenConfigSendSink, *redgenConfigSendRecord)
 			return "", nil
 		}
 		return helpMsg, nil
+	case redgenConfigReplay.FullCommand():
+		return CmdReplayAction(*redgenConfigReplayArg, *redgenConfigReplaySpeed, *redgenConfigReplayFrom, *redgenConfigReplayTo, *redgenConfigReplayTarget, *redgenConfigReplayResume)
+	case redgenConfigPlayback.FullCommand():
+		return CmdPlaybackAction(*redgenConfigPlaybackArg, *redgenConfigPlaybackTarget)
 	case redgenConfigValidate.FullCommand():
 		if *redgenConfigValidateArg != "" {
 			CmdValidateAction(*redgenConfigValidateArg, true)
@@ -53,7 +60,7 @@ func RunAppCommands() (string, error) {
 		return "", nil
 	case redgenConfigProfile.FullCommand():
 		if *redgenConfigProfileArg != "" {
-			CmdProfileAction(*redgenConfigProfileArg)
+			CmdProfileAction(*redgenConfigProfileArg, *redgenConfigProfileSeed, *redgenConfigProfileSpeed, *redgenConfigProfileTo, *redgenConfigProfileStep)
 			return "", nil
 		}
 		return helpMsg, nil
@@ -65,12 +72,13 @@ func RunAppCommands() (string, error) {
 			return "", nil
 		}
 		return helpMsg, nil
+	case redgenMockServer.FullCommand():
+		return CmdMockServer(*redgenMockServerPort, *redgenMockServerToken, *redgenMockServerStore, *redgenMockServerScript)
 	case redgenConfigClear.FullCommand():
 		return "", nil
 	default:
 		return helpMsg, fmt.Errorf("unknown command: %s", enteredCommand)
 	}
-	return "", nil
 }
 
 func CmdInit() (string, error) {
@@ -95,7 +103,9 @@ func CmdGenerate(arg string) (string, error) {
 	}
 }
 
-func CmdProfileAction(filename string) {
+// CmdProfileAction generates the readings of the profile in real time, faster with a speed or instantly when stepping,
+// until the given end if any
+func CmdProfileAction(filename string, seed int64, speed float64, to string, step bool) {
 	fileBytes, err := ioutil.ReadFile(filepath.Join(defaultProfilePath, filename))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -104,16 +114,38 @@ func CmdProfileAction(filename string) {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	GenerateReadings(profile, defaultReadingsPath)
+	profile.ApplySeed(seed)
+	start, _, err := profile.StartAt()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var end time.Time
+	if to != "" {
+		end, err = ParseDate(to)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if speed != 0 || step {
+		if speed == 0 {
+			speed = 1
+		}
+		clock, err = NewClock(speed, start, end, step)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	GenerateReadings(profile, defaultReadingsPath, end)
 }
 
-func CmdPreviewAction(filename string, flag string) {
+func CmdPreviewAction(filename string, flag string, seed int64) {
 	fileBytes, err := ioutil.ReadFile(filepath.Join(defaultProfilePath, filename))
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 	profile, err := NewProfileFromJson(fileBytes)
 	profile.Validate()
+	profile.ApplySeed(seed)
 	fmt.Println("Generating sample consumption data for the profile")
 	profile = GeneratePreviewData(profile, flag)
 
@@ -138,11 +170,6 @@ func CmdPreviewAction(filename string, flag string) {
 }
 
 func GeneratePreviewData(profile Profile, timeFmt string) Profile {
-	var (
-		baseDailyConsumption = profile.BaseDailyConsumption
-		variability          = profile.Variability
-	)
-
 	date, state, err := profile.StartAt()
 
 	if err != nil {
@@ -164,24 +191,68 @@ func GeneratePreviewData(profile Profile, timeFmt string) Profile {
 
 	var readings []Reading
 	for i := 0; i < valuesToGenerate; i++ {
-		hourValue := strconv.Itoa(date.Hour())
-		weekValue := date.Weekday().String()
-		monthValue := date.Month().String()
-		var (
-			hourBase  = profile.HourlyProfiles[hourValue]
-			weekBase  = profile.WeeklyProfiles[weekValue[:3]]
-			monthBase = profile.MonthlyProfiles[monthValue[:3]]
-		)
-		reading := NewReading(date, profile.Unit, profile.Interval, baseDailyConsumption, hourBase, weekBase, monthBase, variability, state)
+		reading := profile.NextReading(profile.NewRand(date), date, state)
 		readings = append(readings, reading)
 
-		time.Sleep(5 * time.Millisecond)
 		date = date.Add(time.Duration(profile.Interval) * time.Minute)
 	}
 	profile.Readings = readings
 	return profile
 }
 
+// CmdBackfillAction generates the readings of the profile for the given period in one pass
+// and stores them in the readings folder, where `config start` continues from them
+func CmdBackfillAction(filename string, from string, to string, seed int64) (string, error) {
+	var fromDate time.Time
+	profile, _ := GetProfileFromFile(filename)
+	profile.ApplySeed(seed)
+	location, err := profile.Location()
+	if err != nil {
+		return "", err
+	}
+	if from != "" {
+		fromDate, err = ParseDateIn(from, location)
+		if err != nil {
+			return "", err
+		}
+	}
+	toDate, err := ParseDateIn(to, location)
+	if err != nil {
+		return "", err
+	}
+	totalReadings := len(profile.Readings)
+	profile, err = GenerateReadingsBetween(profile, fromDate, toDate)
+	if err != nil {
+		return "", err
+	}
+	err = WriteProfileToFile(profile, defaultReadingsPath, filename)
+	if err != nil {
+		return "", err
+	}
+	generated := len(profile.Readings) - totalReadings
+	return fmt.Sprintf("%d readings generated into %s", generated, filepath.Join(defaultReadingsPath, filename)), nil
+}
+
+// ParseDate reads a date given on the command line either as a day (2017-01-01)
+// or as a full RFC3339 time
+func ParseDate(value string) (time.Time, error) {
+	return ParseDateIn(value, time.UTC)
+}
+
+// ParseDateIn reads a date given on the command line like ParseDate,
+// a day being the midnight of the given location
+func ParseDateIn(value string, location *time.Location) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", value, location)
+	if err == nil {
+		return date, nil
+	}
+	date, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return date, fmt.Errorf("the date %s should be in the format 2006-01-02 or 2006-01-02T15:04:05Z07:00", value)
+	}
+	return date, nil
+}
+
 func CmdValidateSingleFile(filename string) {
 	fmt.Printf("attempting to validate profile with name: %s", filename)
 	fileBytes, err := ioutil.ReadFile(filepath.Join(defaultProfilePath, filename))
@@ -213,7 +284,7 @@ func CmdValidateAction(filename string, singleFile bool) {
 	}
 }
 
-func CmdSendReadingsToServer(filename string) {
+func CmdSendReadingsToServer(filename string, sinkNames []string, recordDir string) {
 	fileBytes, err := ioutil.ReadFile(filepath.Join(defaultProfilePath, filename))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -226,48 +297,150 @@ func CmdSendReadingsToServer(filename string) {
 	if err != nil {
 		log.Println("The profile is not valid", profile)
 	}
-	librarianService := new(LibrarianService)
-	// send the readings to the api at this point
-	resp, err := librarianService.sendReadingsAction(profile)
-	fmt.Println("SendReadingsAction() httpResp", resp)
+	config, err := LoadConfig(*redgenConfigFile)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	sinks, err := config.SinksFor(profile, sinkNames)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, sink := range sinks {
+		if librarianService, ok := sink.(*LibrarianService); ok {
+			librarianService.Ledger = ProfileAckLedger(filename, librarianService.Name)
+			if recordDir != "" {
+				librarianService.Recorder = NewRecorder(recordDir)
+			}
+		}
+	}
+	// deliver the readings to the sinks at this point
+	profile, sendErr := DeliverToSinks(profile, sinks)
+	err = WriteProfileToFile(profile, defaultProfilePath, filename)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if sendErr != nil {
+		log.Fatal(sendErr.Error())
+	}
+	fmt.Printf("The readings were delivered to %d sinks\n", len(sinks))
 }
 
-// InitGenerator starts the application and calls the function which runs
-// every 5 seconds for now (should be 15 mins ideally)
-func InitGenerator() (string, error) {
-	t := time.NewTicker(time.Second * 5)
-	for {
-		SendReadingsOnStart()
-		<-t.C
+// StartOptions holds the options of config start shared by all the scheduled profiles
+type StartOptions struct {
+	Seed     int64
+	Until    time.Time
+	Config   Config
+	Sinks    []string
+	Recorder *Recorder
+	Pool     *WorkerPool
+}
+
+// CmdStartAction sets up the clock from the command line options and starts the generator
+func CmdStartAction(seed int64, speed float64, from string, to string, step bool, sinks []string, recordDir string, workers int, rate float64) (string, error) {
+	var (
+		options   = StartOptions{Seed: seed, Sinks: sinks}
+		startDate time.Time
+		err       error
+	)
+	if recordDir != "" {
+		options.Recorder = NewRecorder(recordDir)
+	}
+	options.Pool, err = NewWorkerPool(workers)
+	if err != nil {
+		return "", err
+	}
+	defer options.Pool.Close()
+	if rate != 0 {
+		requestLimiter, err = NewRateLimiter(rate)
+		if err != nil {
+			return "", err
+		}
+		defer func() { requestLimiter = nil }()
+	}
+	options.Config, err = LoadConfig(*redgenConfigFile)
+	if err != nil {
+		return "", err
 	}
+	if from != "" {
+		startDate, err = ParseDate(from)
+		if err != nil {
+			return "", err
+		}
+	}
+	if to != "" {
+		options.Until, err = ParseDate(to)
+		if err != nil {
+			return "", err
+		}
+	}
+	clock, err = NewClock(speed, startDate, options.Until, step)
+	if err != nil {
+		return "", err
+	}
+	return InitGenerator(options)
+}
+
+// InitGenerator starts the application and schedules every parseable profile
+// to run concurrently on the boundaries of its own interval, on the workers of the pool when there is one
+func InitGenerator(options StartOptions) (string, error) {
+	var wg sync.WaitGroup
+	for _, filename := range GetAppendedParsedFileNames() {
+		wg.Add(1)
+		joinClock()
+		go func(filename string) {
+			defer wg.Done()
+			defer leaveClock()
+			ScheduleProfile(filename, options)
+		}(filename)
+	}
+	wg.Wait()
 	return "", nil
 }
 
-func SendReadingsOnStart() {
-	parseableFileNamesList := GetAppendedParsedFileNames()
-	// check if a file with the last reading exists, if not create and leave empty
-	// generate readings at the specified interval in the config and add to the /readings/filename_readings.json file
-	// when you stop the app, and start again, it should get the last reading, compare the time interval of the last reading with current time
-	// account for the time lost by updating the state with an estimated value for the time it was offline but it should continue appending
-	// reading from now (just add the state from say State: 10 -> 12 -> [...offline for three missed readings] -> 20 [14->16->18 skipped] but state added
-	for _, filename := range parseableFileNamesList {
-		profile, _ := GetProfileFromFile(filename)
-		profile = GenerateSingleReading(profile)
-		librarianService := new(LibrarianService)
-		resp, err := librarianService.sendReadingsAction(profile)
-		if err == nil {
-			if resp != nil {
-				if resp.StatusCode == 200 || resp.StatusCode == 201 {
-					SaveReadings(profile, defaultReadingsPath)
-				} else {
-					log.Println("Sent reading responded with a status other than 200 OK success", resp.StatusCode)
-				}
+// ProcessProfile catches the profile up with the given time and delivers the new readings.
+// When the app was stopped, the readings missed while it was offline are generated
+// according to the catch up policy of the profile, so the state continues from the last reading.
+// The readings are delivered to every sink of the profile. Readings an API cannot take are queued
+// in the outbox of the profile and retried on the next runs. The readings are stored with the watermark
+// of the last reading each sink delivered or queued. The caught up profile is returned.
+func ProcessProfile(filename string, at time.Time, options StartOptions) Profile {
+	profile, _ := GetProfileFromFile(filename)
+	profile.ApplySeed(options.Seed)
+	profile, err := CatchUp(profile, at)
+	if err != nil {
+		log.Println("Could not catch up with the readings of the profile", filename, err)
+		return profile
+	}
+	sinks, err := options.Config.SinksFor(profile, options.Sinks)
+	if err != nil {
+		log.Println("Could not deliver the readings of the profile", filename, err)
+	} else {
+		for _, sink := range sinks {
+			if librarianService, ok := sink.(*LibrarianService); ok {
+				librarianService.Outbox = ProfileOutbox(filename, librarianService.Name)
+				librarianService.Ledger = ProfileAckLedger(filename, librarianService.Name)
+				librarianService.Recorder = options.Recorder
 			}
-		} else {
-			log.Println("Encountered an error while sending reading to the API", err)
 		}
-		time.Sleep(time.Second * 1)
+		profile, err = DeliverToSinks(profile, sinks)
+		if err != nil {
+			log.Println("Encountered an error while delivering readings, they will be delivered again", err)
+		}
 	}
+	err = WriteProfileToFile(profile, defaultReadingsPath, filename)
+	if err != nil {
+		log.Println("Could not store the readings of the profile", filename, err)
+		return profile
+	}
+	for _, sink := range sinks {
+		if librarianService, ok := sink.(*LibrarianService); ok {
+			err = librarianService.PruneLedger(profile)
+			if err != nil {
+				log.Println("Could not prune the ledger of the profile", filename, err)
+			}
+		}
+	}
+	return profile
 }
 
 func GetProfileFromFile(filename string) (Profile, bool) {
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Location returns the time zone the readings of the profile are taken in, UTC without a timezone
+func (p Profile) Location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("the timezone %s is not a valid IANA time zone like Europe/Berlin: %s", p.Timezone, err)
+	}
+	return location, nil
+}
+
+// localStart reads a start written in UTC as a wall clock time of the location, so that a profile
+// starting at "2017-01-01T00:00:00Z" starts at the local midnight. A start written with another offset
+// is the instant it says.
+func (p Profile) localStart(location *time.Location) time.Time {
+	start := p.Start
+	if _, offset := start.Zone(); offset != 0 {
+		return start.In(location)
+	}
+	return time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), location)
+}
+
+// ValidateTimezone checks that the timezone, when set, is a known IANA time zone
+func ValidateTimezone(p Profile) error {
+	_, err := p.Location()
+	return err
+}
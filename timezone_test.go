@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFactorsApplyAtLocalTime(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Timezone = "America/New_York"
+	profile.Interval = 60
+	profile.Variability = 0
+	profile.BaseDailyConsumption = 24
+	profile.HourlyProfiles["18"] = 5
+	assert.NoError(t, profile.Validate())
+
+	profile, err := GenerateReadingsBetween(profile, time.Time{}, time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	// the start is the local midnight, five hours after the midnight in UTC
+	assert.Len(t, profile.Readings, 19)
+	first := profile.Readings[0]
+	assert.Equal(t, "2017-01-01T00:00:00-05:00", first.Time.Format(time.RFC3339))
+	evening := profile.Readings[18]
+	assert.Equal(t, 18, evening.Time.Hour())
+	assert.InDelta(t, 5, evening.State-profile.Readings[17].State, 1e-9)
+
+	jsonBytes, err := json.Marshal(evening)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jsonBytes), `"time":"2017-01-01T18:00:00-05:00"`)
+}
+
+func TestDSTDaysHaveTheirLocalHours(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	for day, hours := range map[int]int{25: 24, 26: 23} {
+		profile := CreateDefaultProfile("")
+		profile.Timezone = "Europe/Berlin"
+		profile.Interval = 60
+		profile.Start = time.Date(2017, 3, day, 0, 0, 0, 0, time.UTC)
+		profile, err = GenerateReadingsBetween(profile, time.Time{}, time.Date(2017, 3, day+1, 0, 0, 0, 0, berlin))
+		assert.NoError(t, err)
+		assert.Len(t, profile.Readings, hours)
+	}
+
+	profile := CreateDefaultProfile("")
+	profile.Timezone = "Europe/Berlin"
+	profile.Start = time.Date(2017, 10, 29, 0, 0, 0, 0, time.UTC)
+	profile, err = GenerateReadingsBetween(profile, time.Time{}, time.Date(2017, 10, 30, 0, 0, 0, 0, berlin))
+	assert.NoError(t, err)
+	assert.Len(t, profile.Readings, 25*4)
+	// the readings of the hour repeated at the end of DST keep apart by their offsets
+	assert.Equal(t, "2017-10-29T02:00:00+02:00", profile.Readings[8].Time.Format(time.RFC3339))
+	assert.Equal(t, "2017-10-29T02:00:00+01:00", profile.Readings[12].Time.Format(time.RFC3339))
+}
+
+func TestProfileResumesInItsTimezone(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Timezone = "Europe/Berlin"
+	profile = GenerateSingleReading(profile)
+
+	jsonBytes, err := json.Marshal(profile)
+	assert.NoError(t, err)
+	profile, err = NewProfileFromJson(jsonBytes)
+	assert.NoError(t, err)
+	next, _, err := profile.StartAt()
+	assert.NoError(t, err)
+	assert.Equal(t, "2017-01-01T00:15:00+01:00", next.Format(time.RFC3339))
+	assert.Equal(t, "Europe/Berlin", next.Location().String())
+}
+
+func TestStartWithAnOffsetKeepsItsInstant(t *testing.T) {
+	profile := CreateDefaultProfile("")
+	profile.Timezone = "Europe/Berlin"
+	profile.Start = time.Date(2017, time.January, 1, 0, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	next, _, err := profile.StartAt()
+	assert.NoError(t, err)
+	assert.Equal(t, "2017-01-01T06:00:00+01:00", next.Format(time.RFC3339))
+
+	// a start in UTC is read as a local time
+	profile.Start = time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	next, _, err = profile.StartAt()
+	assert.NoError(t, err)
+	assert.Equal(t, "2017-01-01T00:00:00+01:00", next.Format(time.RFC3339))
+}
+
+func TestValidateTimezone(t *testing.T) {
+	assert.NoError(t, ValidateTimezone(Profile{}))
+	assert.NoError(t, ValidateTimezone(Profile{Timezone: "Europe/Lisbon"}))
+	assert.Error(t, ValidateTimezone(Profile{Timezone: "Mars/Olympus_Mons"}))
+}
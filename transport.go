@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	httpClientsLock sync.Mutex
+	httpClients     = map[string]*http.Client{}
+)
+
+// HTTPClient returns the client sending the requests of the target. A target without transport settings
+// uses the default client; the others get their own client, shared by every service of the target
+// so that connections are reused.
+func (t Target) HTTPClient() (*http.Client, error) {
+	if t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && t.Proxy == "" && t.Timeout == "" {
+		return httpClient, nil
+	}
+	key := strings.Join([]string{t.CAFile, t.CertFile, t.KeyFile, t.Proxy, t.Timeout}, "\n")
+	httpClientsLock.Lock()
+	defer httpClientsLock.Unlock()
+	if client, ok := httpClients[key]; ok {
+		return client, nil
+	}
+	client, err := t.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	httpClients[key] = client
+	return client, nil
+}
+
+func (t Target) newHTTPClient() (*http.Client, error) {
+	timeout, err := t.ClientTimeout()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{}
+	if t.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA file: %s", err)
+		}
+		// the CA file is trusted besides the system roots, which the token URL or the proxy may rely on
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("the CA file %s holds no PEM certificate", t.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if t.Proxy != "" {
+		proxyURL, err := url.Parse(t.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("the proxy %s is not a valid url: %s", t.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// ClientTimeout returns how long a request to the target may take, 10 seconds by default
+func (t Target) ClientTimeout() (time.Duration, error) {
+	if t.Timeout == "" {
+		return httpClient.Timeout, nil
+	}
+	timeout, err := time.ParseDuration(t.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("the timeout %s is not a valid duration: %s", t.Timeout, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("the timeout must be positive, got %s", t.Timeout)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTargetHTTPClientTrustsCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "redgen-transport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	caBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, ioutil.WriteFile(caFile, caBytes, 0644))
+
+	// the certificate of the test server is not trusted by the default client
+	_, err = httpClient.Get(server.URL)
+	assert.Error(t, err)
+
+	client, err := Target{URL: server.URL, CAFile: caFile, Timeout: "5s"}.HTTPClient()
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// the CA file comes on top of the system roots
+	onlyCA := x509.NewCertPool()
+	onlyCA.AppendCertsFromPEM(caBytes)
+	rootCAs := client.Transport.(*http.Transport).TLSClientConfig.RootCAs
+	if system, err := x509.SystemCertPool(); err == nil && !system.Equal(x509.NewCertPool()) {
+		assert.False(t, rootCAs.Equal(onlyCA))
+	}
+
+	same, err := Target{URL: server.URL, CAFile: caFile, Timeout: "5s"}.HTTPClient()
+	assert.NoError(t, err)
+	assert.True(t, client == same)
+}
+
+func TestTargetHTTPClientUsesProxy(t *testing.T) {
+	client, err := Target{Proxy: "http://proxy.example.com:3128"}.HTTPClient()
+	assert.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/readings", nil)
+	proxyURL, err := client.Transport.(*http.Transport).Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &url.URL{Scheme: "http", Host: "proxy.example.com:3128"}, proxyURL)
+
+	defaultClient, err := Target{URL: "https://api.example.com"}.HTTPClient()
+	assert.NoError(t, err)
+	assert.True(t, defaultClient == httpClient)
+
+	_, err = Target{CAFile: "missing.pem"}.HTTPClient()
+	assert.Error(t, err)
+}
+
+func TestValidateTransportSettings(t *testing.T) {
+	config := Config{Targets: map[string]Target{"staging": {URL: "https://staging.example.com", Timeout: "soon"}}}
+	assert.Error(t, config.Validate())
+
+	config.Targets["staging"] = Target{URL: "https://staging.example.com", CertFile: "client.pem"}
+	assert.Error(t, config.Validate())
+
+	config.Targets["staging"] = Target{URL: "https://staging.example.com", CertFile: "client.pem", KeyFile: "client.key", Timeout: "30s"}
+	assert.NoError(t, config.Validate())
+}
@@ -42,7 +42,7 @@ func GetValueforUnit(unit string) float64 {
 
 // IsUnitValid checks if the given unit is one of [W, KW, MW or GW]
 func IsUnitValid(value string) bool {
-	return value < string(end)
+	return value < string(rune(end))
 }
 
 // IsValueInList checks if a given string is present in a list of strings
@@ -86,11 +86,11 @@ func ValidateHourlyProfiles(p Profile) error {
 		}
 		if value <= 0 {
 			// The value set for an hour must be a minimum of 1
-			err = fmt.Errorf("the minimum for any hour should be 1 , hour %+v has the value: %d", hour, value)
+			err = fmt.Errorf("the minimum for any hour should be 1 , hour %+v has the value: %v", hour, value)
 		}
 		if p.Unit != "w" && p.Unit != "kW" && value > 100 {
 			// The value set for an hour is too large
-			err = fmt.Errorf("the hour %+v is too large with value: %d", hour, value)
+			err = fmt.Errorf("the hour %+v is too large with value: %v", hour, value)
 		}
 	}
 
@@ -112,11 +112,11 @@ func ValidateWeeklyProfiles(p Profile) error {
 		}
 		if value <= 0 {
 			// The value set for a week must be a minimum of 1
-			err = fmt.Errorf("the minimum for any week should be 1 , week %+v has the value: %d", weekDay, value)
+			err = fmt.Errorf("the minimum for any week should be 1 , week %+v has the value: %v", weekDay, value)
 		}
 		if p.Unit != "w" && p.Unit != "kW" && value > 100 {
 			// The value set for a week is too large
-			err = fmt.Errorf("the week %+v is too large with value: %d", weekDay, value)
+			err = fmt.Errorf("the week %+v is too large with value: %v", weekDay, value)
 		}
 	}
 
@@ -138,11 +138,11 @@ func ValidateMonthlyProfiles(p Profile) error {
 		}
 		if value <= 0 {
 			// The value set for a month must be a minimum of 1
-			err = fmt.Errorf("the minimum for any month should be 1 , month %+v has the value: %d", aMonth, value)
+			err = fmt.Errorf("the minimum for any month should be 1 , month %+v has the value: %v", aMonth, value)
 		}
 		if p.Unit != "w" && p.Unit != "kW" && value > 100 {
 			// The value set for a week is too large
-			err = fmt.Errorf("the month %+v is too large with value: %d", aMonth, value)
+			err = fmt.Errorf("the month %+v is too large with value: %v", aMonth, value)
 		}
 	}
 
@@ -208,12 +208,12 @@ func ValidateStart(p Profile) error {
 
 	if !IsValueInList(start.Month().String()[:3], months) {
 		// The week entered is not valid
-		err = fmt.Errorf("the value set for month %+v is not valid, must be one of: %+v", start.Month, months)
+		err = fmt.Errorf("the value set for month %+v is not valid, must be one of: %+v", start.Month(), months)
 	}
 
 	if !IsIntValueInList(start.Hour(), hoursOfDay) {
 		// The hour set isn't a valid hour
-		err = fmt.Errorf("the hour %+v is not a valid hour, should be one of: %+v", start.Hour, hoursOfDay)
+		err = fmt.Errorf("the hour %+v is not a valid hour, should be one of: %+v", start.Hour(), hoursOfDay)
 	}
 
 	if start.Year() <= 1990 || start.Year() > 2030 {
@@ -272,6 +272,7 @@ func ValidateUnit(p Profile) error {
 
 // validateProfile validates all the properties of the Profile struct
 // calls the appropriate validation method for each field
+// the validators of the base fields are in this file, the ones of a feature in the file of the feature
 func (p *Profile) Validate() error {
 	err := ValidateName(*p)
 	if err != nil {
@@ -298,11 +299,31 @@ func (p *Profile) Validate() error {
 		return err
 	}
 
+	err = ValidateDayCurves(*p)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateHolidayCalendar(*p)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateInterpolation(*p)
+	if err != nil {
+		return err
+	}
+
 	err = ValidateStart(*p)
 	if err != nil {
 		return err
 	}
 
+	err = ValidateTimezone(*p)
+	if err != nil {
+		return err
+	}
+
 	err = ValidateReadings(*p)
 	if err != nil {
 		return err
@@ -313,6 +334,11 @@ func (p *Profile) Validate() error {
 		return err
 	}
 
+	err = ValidateNoise(*p)
+	if err != nil {
+		return err
+	}
+
 	err = ValidateInterval(*p)
 	if err != nil {
 		return err
@@ -323,5 +349,20 @@ func (p *Profile) Validate() error {
 		return err
 	}
 
+	err = ValidateCatchUp(*p)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateAnomalies(*p)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateRegister(*p)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
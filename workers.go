@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultWorkers = 16
+
+// WorkerPool runs the jobs of every profile on a fixed number of workers,
+// so that a large fleet of profiles due at the same time does not process all at once
+type WorkerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+func NewWorkerPool(workers int) (*WorkerPool, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("the number of workers must be at least 1, got %d", workers)
+	}
+	pool := &WorkerPool{jobs: make(chan func())}
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.jobs {
+				job()
+			}
+		}()
+	}
+	return pool, nil
+}
+
+// Run waits for a free worker, runs the job on it and returns once the job is done.
+// Without a pool, the job runs right away.
+func (p *WorkerPool) Run(job func()) {
+	if p == nil {
+		job()
+		return
+	}
+	done := make(chan struct{})
+	p.jobs <- func() {
+		defer close(done)
+		job()
+	}
+	<-done
+}
+
+// Close stops the workers once the jobs they run are done
+func (p *WorkerPool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// requestLimiter caps the requests sent over HTTP by every sink of the run, none by default
+var requestLimiter *RateLimiter
+
+// RateLimiter spaces the requests sent over HTTP so that no more than the given number go out per second,
+// whichever profile or sink sends them
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func NewRateLimiter(requestsPerSecond float64) (*RateLimiter, error) {
+	if requestsPerSecond <= 0 {
+		return nil, fmt.Errorf("the rate must be greater than 0 requests per second, got %v", requestsPerSecond)
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}, nil
+}
+
+// Wait blocks until the next request may be sent. The limit is on real time, whatever the speed of the clock.
+// Without a limiter, requests are sent right away.
+func (l *RateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(wait)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolLimitsConcurrency(t *testing.T) {
+	pool, err := NewWorkerPool(3)
+	assert.NoError(t, err)
+	defer pool.Close()
+
+	var (
+		mu         sync.Mutex
+		running    int
+		maxRunning int
+		done       int
+		wg         sync.WaitGroup
+	)
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(func() {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				done++
+				mu.Unlock()
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 12, done)
+	assert.True(t, maxRunning <= 3)
+
+	_, err = NewWorkerPool(0)
+	assert.Error(t, err)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter(100)
+	assert.NoError(t, err)
+	started := time.Now()
+	for i := 0; i < 6; i++ {
+		limiter.Wait()
+	}
+	// the first request goes out right away, the next ones 10ms apart
+	assert.True(t, time.Since(started) >= 50*time.Millisecond)
+
+	var unlimited *RateLimiter
+	unlimited.Wait()
+	_, err = NewRateLimiter(0)
+	assert.Error(t, err)
+}
+
+func TestEveryHTTPRequestIsRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	limiter, err := NewRateLimiter(20)
+	assert.NoError(t, err)
+	requestLimiter = limiter
+	defer func() { requestLimiter = nil }()
+
+	profile := CreateDefaultProfile("")
+	profile, err = GenerateReadingsBetween(profile, profile.Start, profile.Start.Add(15*time.Minute))
+	assert.NoError(t, err)
+	webhook, err := NewWebhookSink("hook", SinkConfig{URL: server.URL})
+	assert.NoError(t, err)
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err = webhook.Deliver(profile)
+		assert.NoError(t, err)
+	}
+	assert.True(t, time.Since(started) >= 100*time.Millisecond)
+}